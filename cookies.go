@@ -0,0 +1,206 @@
+//// file: cookies.go
+
+package stew
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================
+//                    Declarations
+// =============================================
+
+// prefix netscape cookie files use to mark http-only entries
+const httpOnlyPrefix = "#HttpOnly_"
+
+// browserCookie pairs an exported cookie with the host it was issued for
+type browserCookie struct {
+	host   string
+	cookie *http.Cookie
+}
+
+// jsonCookie is a single entry of a browser JSON cookie export
+// (Chrome extensions such as EditThisCookie and Cookie-Editor)
+type jsonCookie struct {
+	Domain         string  `json:"domain"`
+	ExpirationDate float64 `json:"expirationDate"`
+	HostOnly       bool    `json:"hostOnly"`
+	HTTPOnly       bool    `json:"httpOnly"`
+	Name           string  `json:"name"`
+	Path           string  `json:"path"`
+	Secure         bool    `json:"secure"`
+	Session        bool    `json:"session"`
+	Value          string  `json:"value"`
+}
+
+// =============================================
+//                    Public
+// =============================================
+
+// LoadCookies ...
+// Reads browser-exported cookies into jar, accepting either
+// Netscape cookies.txt or Chrome JSON export format.
+// New fetches through http.DefaultClient, so loading into its Jar
+// lets scrapes reuse an interactive browser session
+func LoadCookies(jar http.CookieJar, r io.Reader) error {
+	br := bufio.NewReader(r)
+	var cookies []browserCookie
+	var err error
+	if isJSONExport(br) {
+		cookies, err = parseJSONCookies(br)
+	} else {
+		cookies, err = parseNetscapeCookies(br)
+	}
+	if err != nil {
+		return err
+	}
+	for _, bc := range cookies {
+		jar.SetCookies(bc.url(), []*http.Cookie{bc.cookie})
+	}
+	return nil
+}
+
+// LoadCookieFile ...
+// Reads browser-exported cookies from input file into jar
+func LoadCookieFile(jar http.CookieJar, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return LoadCookies(jar, f)
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+// url returns the address the cookie would have been set from
+func (this browserCookie) url() *url.URL {
+	scheme := "http"
+	if this.cookie.Secure {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: this.host, Path: this.cookie.Path}
+}
+
+// newBrowserCookie normalizes exported domain and path fields
+func newBrowserCookie(domain string, hostOnly bool, cookie *http.Cookie) browserCookie {
+	host := strings.TrimPrefix(domain, ".")
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	if !hostOnly {
+		// a non-empty Domain makes the jar match subdomains as well
+		cookie.Domain = host
+	}
+	return browserCookie{host: host, cookie: cookie}
+}
+
+// isJSONExport peeks past leading whitespace for a JSON array or object
+func isJSONExport(br *bufio.Reader) bool {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return false
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		br.UnreadByte()
+		return b == '[' || b == '{'
+	}
+}
+
+// parseNetscapeCookies reads tab separated cookies.txt lines of the form
+// domain, include subdomains, path, secure, expiry, name, value
+func parseNetscapeCookies(r io.Reader) ([]browserCookie, error) {
+	var cookies []browserCookie
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		if httpOnly {
+			line = line[len(httpOnlyPrefix):]
+		}
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("cookies.txt line %d: expected 7 fields, got %d",
+				lineno, len(fields))
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cookies.txt line %d: bad expiry %q", lineno, fields[4])
+		}
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    strings.Join(fields[6:], "\t"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if expiry > 0 {
+			cookie.Expires = time.Unix(expiry, 0)
+		}
+		hostOnly := !strings.EqualFold(fields[1], "TRUE")
+		cookies = append(cookies, newBrowserCookie(fields[0], hostOnly, cookie))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cookies, nil
+}
+
+// parseJSONCookies reads a JSON array (or single object) of exported cookies
+func parseJSONCookies(r io.Reader) ([]browserCookie, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	var entries []jsonCookie
+	if len(raw) > 0 && raw[0] == '{' {
+		var entry jsonCookie
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	} else if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, err
+	}
+
+	cookies := make([]browserCookie, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Domain == "" {
+			return nil, fmt.Errorf("cookie %q has no domain", entry.Name)
+		}
+		cookie := &http.Cookie{
+			Name:     entry.Name,
+			Value:    entry.Value,
+			Path:     entry.Path,
+			Secure:   entry.Secure,
+			HttpOnly: entry.HTTPOnly,
+		}
+		if !entry.Session && entry.ExpirationDate > 0 {
+			sec, frac := math.Modf(entry.ExpirationDate)
+			cookie.Expires = time.Unix(int64(sec), int64(frac*1e9))
+		}
+		cookies = append(cookies, newBrowserCookie(entry.Domain, entry.HostOnly, cookie))
+	}
+	return cookies, nil
+}
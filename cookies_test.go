@@ -0,0 +1,118 @@
+//// file: cookies_test.go
+
+package stew
+
+import (
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// =============================================
+//                    Globals
+// =============================================
+
+const netscapeCookies = `# Netscape HTTP Cookie File
+# This is a generated file!  Do not edit.
+
+.example.com	TRUE	/	FALSE	4102444800	sid	abc123
+#HttpOnly_www.example.com	FALSE	/account	TRUE	0	token	secret
+expired.example.com	FALSE	/	FALSE	1	old	gone
+`
+
+const jsonCookies = `[
+	{"domain": ".example.com", "hostOnly": false, "name": "sid", "path": "/",
+		"secure": false, "session": false, "expirationDate": 4102444800.5, "value": "abc123"},
+	{"domain": "www.example.com", "hostOnly": true, "httpOnly": true, "name": "token",
+		"path": "/account", "secure": true, "session": true, "value": "secret"}
+]`
+
+// =============================================
+//                    Tests
+// =============================================
+
+// TestLoadNetscapeCookies ...
+// Validates LoadCookies on cookies.txt input
+func TestLoadNetscapeCookies(t *testing.T) {
+	jar := newTestJar()
+	if err := LoadCookies(jar, strings.NewReader(netscapeCookies)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cookieCheck(t, jar)
+
+	got := cookieNames(jar, "http://expired.example.com/")
+	if strings.Join(got, ";") != "sid=abc123" {
+		t.Errorf("expecting expired cookies to be dropped, got %v", got)
+	}
+}
+
+// TestLoadJSONCookies ...
+// Validates LoadCookies on Chrome JSON export input
+func TestLoadJSONCookies(t *testing.T) {
+	jar := newTestJar()
+	if err := LoadCookies(jar, strings.NewReader(jsonCookies)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cookieCheck(t, jar)
+}
+
+// TestLoadBadCookies ...
+// Ensures malformed exports are rejected
+func TestLoadBadCookies(t *testing.T) {
+	bad := []string{
+		"example.com\tTRUE\t/\n",
+		"example.com\tTRUE\t/\tFALSE\tnever\tsid\tabc\n",
+		`[{"name": "sid", "value": "abc"}]`,
+		`[{"domain": ".example.com"`,
+	}
+	for _, in := range bad {
+		if err := LoadCookies(newTestJar(), strings.NewReader(in)); err == nil {
+			t.Errorf("expecting error loading %q", in)
+		}
+	}
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+func newTestJar() *cookiejar.Jar {
+	jar, err := cookiejar.New(nil)
+	panicCheck(err)
+	return jar
+}
+
+func cookieNames(jar *cookiejar.Jar, link string) []string {
+	u, err := url.Parse(link)
+	panicCheck(err)
+	names := []string{}
+	for _, c := range jar.Cookies(u) {
+		names = append(names, c.Name+"="+c.Value)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func cookieCheck(t *testing.T, jar *cookiejar.Jar) {
+	expectations := []struct {
+		link  string
+		names []string
+	}{
+		// domain cookies match subdomains, host cookies only their host
+		{"http://example.com/", []string{"sid=abc123"}},
+		{"http://shop.example.com/", []string{"sid=abc123"}},
+		// secure cookies are withheld from plain http
+		{"http://www.example.com/account", []string{"sid=abc123"}},
+		{"https://www.example.com/account/settings", []string{"sid=abc123", "token=secret"}},
+		{"https://www.example.com/", []string{"sid=abc123"}},
+		{"http://example.org/", []string{}},
+	}
+	for _, exp := range expectations {
+		got := cookieNames(jar, exp.link)
+		if strings.Join(exp.names, ";") != strings.Join(got, ";") {
+			t.Errorf("@%s expected cookies %v, got %v", exp.link, exp.names, got)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+//// file: datauri.go
+
+package stew
+
+import (
+	"encoding/base64"
+	"errors"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// =============================================
+//                    Declarations
+// =============================================
+
+// ErrNotDataURI is returned when parsing a URI without the data: scheme
+var ErrNotDataURI = errors.New("stew: not a data URI")
+
+// attributes scanned for inline resources
+var resourceAttrs = []string{"src", "href"}
+
+// preferred extensions for common media types, where the mime package
+// would otherwise pick an obscure alias such as .jfif for image/jpeg
+var preferredExts = map[string]string{
+	"image/jpeg":              ".jpg",
+	"image/png":               ".png",
+	"image/gif":               ".gif",
+	"image/webp":              ".webp",
+	"image/svg+xml":           ".svg",
+	"text/plain":              ".txt",
+	"text/html":               ".html",
+	"font/woff":               ".woff",
+	"font/woff2":              ".woff2",
+	"application/font-woff":   ".woff",
+	"application/font-woff2":  ".woff2",
+	"application/x-font-woff": ".woff",
+}
+
+// DataURI ...
+// Is the decoded content of an RFC 2397 data: URI
+type DataURI struct {
+	// MediaType defaults to text/plain when the URI omits it
+	MediaType string
+	// Params holds media type parameters such as charset
+	Params map[string]string
+	Data   []byte
+}
+
+// InlineResource ...
+// Is a data: URI found in an attribute of a Stew node
+type InlineResource struct {
+	Node *Stew
+	Attr string
+	*DataURI
+}
+
+// =============================================
+//                    Public
+// =============================================
+
+// IsDataURI ...
+// Returns whether input string uses the data: scheme
+func IsDataURI(uri string) bool {
+	uri = strings.TrimSpace(uri)
+	return len(uri) >= 5 && strings.EqualFold(uri[:5], "data:")
+}
+
+// ParseDataURI ...
+// Decodes input data: URI into its media type and bytes
+func ParseDataURI(uri string) (*DataURI, error) {
+	if !IsDataURI(uri) {
+		return nil, ErrNotDataURI
+	}
+	uri = strings.TrimSpace(uri)[5:]
+	comma := strings.IndexByte(uri, ',')
+	if comma < 0 {
+		return nil, errors.New("stew: data URI has no ',' separator")
+	}
+	header, payload := uri[:comma], uri[comma+1:]
+
+	result := &DataURI{MediaType: "text/plain",
+		Params: map[string]string{"charset": "US-ASCII"}}
+	isBase64 := false
+	if parts := strings.Split(header, ";"); len(parts) > 0 {
+		if last := len(parts) - 1; last > 0 && strings.EqualFold(parts[last], "base64") {
+			isBase64 = true
+			parts = parts[:last]
+		}
+		if typ := strings.TrimSpace(parts[0]); typ != "" {
+			result.MediaType = strings.ToLower(typ)
+			result.Params = make(map[string]string)
+		}
+		for _, param := range parts[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) == 2 {
+				result.Params[strings.ToLower(strings.TrimSpace(kv[0]))] = kv[1]
+			}
+		}
+	}
+
+	data, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !isBase64 {
+		result.Data = []byte(data)
+		return result, nil
+	}
+	// tolerate whitespace and missing padding left by html line wrapping
+	data = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			return -1
+		}
+		return r
+	}, data)
+	data = strings.TrimRight(data, "=")
+	if strings.ContainsAny(data, "-_") {
+		result.Data, err = base64.RawURLEncoding.DecodeString(data)
+	} else {
+		result.Data, err = base64.RawStdEncoding.DecodeString(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Ext ...
+// Returns a file extension for the media type, or empty string if unknown
+func (this *DataURI) Ext() string {
+	if ext, ok := preferredExts[this.MediaType]; ok {
+		return ext
+	}
+	exts, err := mime.ExtensionsByType(this.MediaType)
+	if err != nil || len(exts) == 0 {
+		return ""
+	}
+	return exts[0]
+}
+
+// InlineResources ...
+// Returns decodable data: URIs in src/href attributes of this node
+// and its descendants, in document order. Malformed URIs are skipped
+func (this *Stew) InlineResources() []InlineResource {
+	results := []InlineResource{}
+	for _, node := range newDocIndex(this).order {
+		for _, attr := range resourceAttrs {
+			for _, val := range node.Attrs[attr] {
+				if !IsDataURI(val) {
+					continue
+				}
+				if uri, err := ParseDataURI(val); err == nil {
+					results = append(results, InlineResource{node, attr, uri})
+				}
+			}
+		}
+	}
+	return results
+}
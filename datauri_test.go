@@ -0,0 +1,113 @@
+//// file: datauri_test.go
+
+package stew
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/mingkaic/gardener"
+)
+
+// =============================================
+//                    Tests
+// =============================================
+
+// TestParseDataURI ...
+// Validates media type, params and payload decoding
+func TestParseDataURI(t *testing.T) {
+	expectations := []struct {
+		uri       string
+		mediaType string
+		params    map[string]string
+		data      string
+	}{
+		{"data:,A%20brief%20note", "text/plain",
+			map[string]string{"charset": "US-ASCII"}, "A brief note"},
+		{"data:image/png;base64,iVBORw0KGgo=", "image/png",
+			map[string]string{}, "\x89PNG\r\n\x1a\n"},
+		{"DATA:Text/HTML;charset=UTF-8;base64,PGI+aGk8L2I+", "text/html",
+			map[string]string{"charset": "UTF-8"}, "<b>hi</b>"},
+		{" data:;base64,aGVs\n bG8 ", "text/plain",
+			map[string]string{"charset": "US-ASCII"}, "hello"},
+		{"data:application/octet-stream;base64,_-8", "application/octet-stream",
+			map[string]string{}, "\xff\xef"},
+	}
+	for _, exp := range expectations {
+		uri, err := ParseDataURI(exp.uri)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", exp.uri, err)
+			continue
+		}
+		if uri.MediaType != exp.mediaType {
+			t.Errorf("%q: expected media type %s, got %s", exp.uri, exp.mediaType, uri.MediaType)
+		}
+		if !reflect.DeepEqual(exp.params, uri.Params) {
+			t.Errorf("%q: expected params %v, got %v", exp.uri, exp.params, uri.Params)
+		}
+		if string(uri.Data) != exp.data {
+			t.Errorf("%q: expected data %q, got %q", exp.uri, exp.data, uri.Data)
+		}
+	}
+
+	if _, err := ParseDataURI("http://example.com/a.png"); err != ErrNotDataURI {
+		t.Errorf("expected ErrNotDataURI, got %v", err)
+	}
+	for _, bad := range []string{"data:image/png;base64", "data:;base64,!!!", "data:,%zz"} {
+		if _, err := ParseDataURI(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+// TestInlineResources ...
+// Validates data URIs are collected from src/href attributes
+func TestInlineResources(t *testing.T) {
+	const inlineHTML = `<html><head><link rel="icon" href="data:image/png;base64,iVBORw0KGgo="></head>
+		<body><img src="/a.png"><img src="data:,hi"><a href="data:;base64,!!!">bad</a></body></html>`
+	var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(inlineHTML)}
+	resources := NewFromReader(rc).InlineResources()
+
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 inline resources, got %d", len(resources))
+	}
+	if resources[0].Node.Tag != "link" || resources[0].Attr != "href" || resources[0].Ext() != ".png" {
+		t.Errorf("expected png icon first, got <%s %s> %s",
+			resources[0].Node.Tag, resources[0].Attr, resources[0].MediaType)
+	}
+	if resources[1].Node.Tag != "img" || string(resources[1].Data) != "hi" {
+		t.Errorf("expected inline img text second, got <%s> %q",
+			resources[1].Node.Tag, resources[1].Data)
+	}
+
+	// nested resources come before later shallower ones
+	const nestedHTML = `<html><body><div><img src="data:,A"></div><img src="data:,B"></body></html>`
+	rc = &gardener.MockRC{bytes.NewBufferString(nestedHTML)}
+	resources = NewFromReader(rc).InlineResources()
+	if len(resources) != 2 || string(resources[0].Data) != "A" || string(resources[1].Data) != "B" {
+		t.Errorf("expected inline resources in document order [A B], got %d", len(resources))
+	}
+}
+
+// TestDataURIExt ...
+// Validates common media types map to their usual extensions
+func TestDataURIExt(t *testing.T) {
+	exts := map[string]string{
+		"image/jpeg":            ".jpg",
+		"image/png":             ".png",
+		"text/plain":            ".txt",
+		"text/html":             ".html",
+		"image/svg+xml":         ".svg",
+		"font/woff2":            ".woff2",
+		"application/font-woff": ".woff",
+		"application/x-unknown": "",
+	}
+	for mediaType, expect := range exts {
+		uri := &DataURI{MediaType: mediaType}
+		if got := uri.Ext(); got != expect {
+			t.Errorf("%s: expected extension %q, got %q", mediaType, expect, got)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+//// file: embed.go
+
+package stew
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// =============================================
+//                    Declarations
+// =============================================
+
+// cheap check for something shaped like a start or end tag
+var tagPattern = regexp.MustCompile(`</?[a-zA-Z][a-zA-Z0-9-]*(\s[^<>]*)?/?>`)
+
+// =============================================
+//                    Public
+// =============================================
+
+// ParseEmbedded ...
+// Detects html embedded in attribute values, and in JSON string values of
+// attributes and text content, of this node and its descendants. Each is
+// re-parsed into a fragment tree stored in the carrier's Fragments under
+// the attribute key. Plain text is never a carrier, since escaped markup
+// in prose and code samples is meant to be read as text.
+// Options apply to the fragment trees. Returns carriers in document order
+func (this *Stew) ParseEmbedded(opts ...Option) []*Stew {
+	carriers := []*Stew{}
+	for _, node := range newDocIndex(this).order {
+		fragments := make(map[string][]*Stew)
+		for key, vals := range node.Attrs {
+			jsonOnly := key == ""
+			for _, val := range vals {
+				for _, embedded := range embeddedHTML(val, jsonOnly) {
+					if frag := parseFragment(embedded, node, opts); frag != nil {
+						fragments[key] = append(fragments[key], frag)
+					}
+				}
+			}
+		}
+		if len(fragments) > 0 {
+			node.Fragments = fragments
+			carriers = append(carriers, node)
+		}
+	}
+	return carriers
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+// embeddedHTML returns the html-looking string values of val as JSON,
+// otherwise val itself if it looks like html and jsonOnly is false
+func embeddedHTML(val string, jsonOnly bool) []string {
+	trimmed := strings.TrimSpace(val)
+	if len(trimmed) == 0 {
+		return nil
+	}
+	if trimmed[0] == '{' || trimmed[0] == '[' {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(trimmed), &doc); err == nil {
+			return jsonHTMLStrings(doc, nil)
+		}
+	}
+	if !jsonOnly && tagPattern.MatchString(trimmed) {
+		return []string{trimmed}
+	}
+	return nil
+}
+
+// jsonHTMLStrings collects html-looking strings from decoded JSON,
+// visiting object members in key order
+func jsonHTMLStrings(doc interface{}, out []string) []string {
+	switch v := doc.(type) {
+	case string:
+		if tagPattern.MatchString(v) {
+			out = append(out, strings.TrimSpace(v))
+		}
+	case []interface{}:
+		for _, elem := range v {
+			out = jsonHTMLStrings(elem, out)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			out = jsonHTMLStrings(v[key], out)
+		}
+	}
+	return out
+}
+
+// parseFragment builds a fragment tree under carrier,
+// returning nil if the string holds no elements after all
+func parseFragment(embedded string, carrier *Stew, opts []Option) *Stew {
+	nodes, err := parseInBody(embedded)
+	if err != nil {
+		return nil
+	}
+	holder := &html.Node{Type: html.DocumentNode}
+	hasElem := false
+	for _, node := range nodes {
+		hasElem = hasElem || node.Type == html.ElementNode
+		holder.AppendChild(node)
+	}
+	if !hasElem {
+		return nil
+	}
+	frag := NewFromNode(holder, opts...)
+	frag.Parent = carrier
+	return frag
+}
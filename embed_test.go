@@ -0,0 +1,101 @@
+//// file: embed_test.go
+
+package stew
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/mingkaic/gardener"
+)
+
+// =============================================
+//                    Globals
+// =============================================
+
+const embeddedHTMLPage = `<html><body>
+<span data-content="&lt;div class=&quot;tip&quot;&gt;&lt;b&gt;bold&lt;/b&gt; tip&lt;/div&gt;">hover</span>
+<span title="1 < 2 > 0">plain</span>
+<script type="application/json">{"b": "<p>second</p>", "a": ["<i>first</i>", "no tags"]}</script>
+<script>document.write("<b>not markup</b>")</script>
+<p>Wrap it in a &lt;b&gt; tag</p><code>&lt;div class="x"&gt;&lt;/div&gt;</code>
+</body></html>`
+
+// =============================================
+//                    Tests
+// =============================================
+
+// TestParseEmbedded ...
+// Validates embedded html strings are re-parsed into linked fragments
+func TestParseEmbedded(t *testing.T) {
+	var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(embeddedHTMLPage)}
+	stewie := NewFromReader(rc)
+	carriers := stewie.ParseEmbedded()
+
+	if len(carriers) != 2 {
+		t.Fatalf("expecting 2 carriers, got %d", len(carriers))
+	}
+	span, script := carriers[0], carriers[1]
+	if span.Tag != "span" || script.Tag != "script" {
+		t.Fatalf("expecting span and script carriers, got %s and %s", span.Tag, script.Tag)
+	}
+
+	frags := span.Fragments["data-content"]
+	if len(frags) != 1 || frags[0].Parent != span {
+		t.Fatalf("expecting 1 fragment linked to span, got %v", frags)
+	}
+	tips := frags[0].Find("class", "tip")
+	if len(tips) != 1 || tips[0].Tag != "div" {
+		t.Errorf("expecting div.tip in fragment, got %v", tips)
+	}
+	bolds := frags[0].FindAll("b")
+	if len(bolds) != 1 || !reflect.DeepEqual([]string{"bold"}, bolds[0].Attrs[""]) {
+		t.Errorf("expecting bold text in fragment, got %v", bolds)
+	}
+	if len(stewie.FindAll("div")) > 0 {
+		t.Errorf("expecting fragments to stay out of the main tree")
+	}
+
+	frags = script.Fragments[""]
+	if len(frags) != 2 {
+		t.Fatalf("expecting 2 json fragments, got %d", len(frags))
+	}
+	if len(frags[0].FindAll("i")) != 1 || len(frags[1].FindAll("p")) != 1 {
+		t.Errorf("expecting json fragments in key order")
+	}
+
+	// canonical text mode leaves json script bodies parseable
+	rc = &gardener.MockRC{bytes.NewBufferString(embeddedHTMLPage)}
+	canonical := NewFromReader(rc, WithTextMode(TextCanonical)).ParseEmbedded()
+	if len(canonical) != len(carriers) {
+		t.Errorf("expecting %d carriers in canonical text mode, got %d", len(carriers), len(canonical))
+	}
+
+	// escaped markup in prose and code samples stays text
+	for _, tag := range []string{"p", "code"} {
+		for _, node := range stewie.FindAll(tag) {
+			if len(node.Fragments) > 0 {
+				t.Errorf("expecting %s text not to carry fragments, got %v", tag, node.Fragments)
+			}
+		}
+	}
+}
+
+// TestParseEmbeddedOrder ...
+// Validates carriers are returned in document order
+func TestParseEmbeddedOrder(t *testing.T) {
+	const nestedCarriers = `<html><body><section><span data-x="&lt;b&gt;A&lt;/b&gt;"></span></section>
+		<span data-x="&lt;b&gt;B&lt;/b&gt;"></span></body></html>`
+	var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(nestedCarriers)}
+	carriers := NewFromReader(rc).ParseEmbedded()
+
+	got := []string{}
+	for _, carrier := range carriers {
+		got = append(got, carrier.Fragments["data-x"][0].FindAll("b")[0].Attrs[""][0])
+	}
+	if !reflect.DeepEqual([]string{"A", "B"}, got) {
+		t.Errorf("expecting carriers in document order [A B], got %v", got)
+	}
+}
@@ -0,0 +1,112 @@
+//// file: fixture.go
+
+package stew
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// =============================================
+//                    Declarations
+// =============================================
+
+// ErrNoFixture is returned when replaying a request that was never recorded
+var ErrNoFixture = errors.New("stew: no fixture for request")
+
+// FixtureMode ...
+// Selects whether FixtureTransport records or replays responses
+type FixtureMode int
+
+const (
+	// FixtureReplay serves recorded responses and never touches the network
+	FixtureReplay FixtureMode = iota
+	// FixtureRecord sends every request and saves its response
+	FixtureRecord
+	// FixtureRecordMissing replays recorded responses and records the rest
+	FixtureRecordMissing
+)
+
+// FixtureTransport ...
+// Is an http.RoundTripper recording responses to fixture files and
+// replaying them, so scraper tests run without the network.
+// Install it as the Transport of http.DefaultClient, which New uses,
+// or of Scheduler.Client. Fixtures are keyed by method and URL,
+// one raw HTTP response per file in Dir
+type FixtureTransport struct {
+	Dir  string
+	Mode FixtureMode
+	// Next sends recorded requests, http.DefaultTransport if nil
+	Next http.RoundTripper
+}
+
+// =============================================
+//                    Public
+// =============================================
+
+// RoundTrip ...
+// Replays or records the response to req according to Mode
+func (this *FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := filepath.Join(this.Dir, fixtureName(req))
+	if this.Mode != FixtureRecord {
+		resp, err := readFixture(path, req)
+		if err != ErrNoFixture || this.Mode == FixtureReplay {
+			return resp, err
+		}
+	}
+
+	next := this.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// DumpResponse buffers the body and leaves resp readable
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if err := os.MkdirAll(this.Dir, 0755); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, dump, 0644); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+// fixtureName is the method followed by a hash of the full URL
+func fixtureName(req *http.Request) string {
+	return fmt.Sprintf("%s-%x.http", strings.ToLower(req.Method),
+		sha1.Sum([]byte(req.URL.String())))
+}
+
+// readFixture parses the recorded response to req at path,
+// returning ErrNoFixture if there is none
+func readFixture(path string, req *http.Request) (*http.Response, error) {
+	dump, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoFixture
+	} else if err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(dump)), req)
+}
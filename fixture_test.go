@@ -0,0 +1,87 @@
+//// file: fixture_test.go
+
+package stew
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+// =============================================
+//                    Tests
+// =============================================
+
+// TestFixtureTransport ...
+// Validates recorded responses are replayed by New without the network
+func TestFixtureTransport(t *testing.T) {
+	dir := tempDir()
+	defer os.RemoveAll(dir)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Page", r.URL.Query().Get("q"))
+		fmt.Fprint(w, "<html><head><title>recorded</title></head></html>")
+	}))
+	page := srv.URL + "/page?q=1"
+
+	recorder := &http.Client{Transport: &FixtureTransport{Dir: dir, Mode: FixtureRecord}}
+	resp, err := recorder.Get(page)
+	panicCheck(err)
+	if titles := NewFromRes(resp).FindAll("title"); len(titles) != 1 {
+		t.Fatalf("expected recorded page to be readable, got %d titles", len(titles))
+	}
+	srv.Close() // replaying must not reach the server
+
+	defer func(rt http.RoundTripper) {
+		http.DefaultClient.Transport = rt
+	}(http.DefaultClient.Transport)
+	http.DefaultClient.Transport = &FixtureTransport{Dir: dir}
+	titles := New(page).FindAll("title")
+	if len(titles) != 1 || titles[0].Attrs[""][0] != "recorded" {
+		t.Errorf("expected replayed title, got %v", titles)
+	}
+
+	resp, err = http.Get(page)
+	panicCheck(err)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Page") != "1" {
+		t.Errorf("expected replayed status and header, got %s %v", resp.Status, resp.Header)
+	}
+
+	_, err = http.Get(srv.URL + "/page?q=2")
+	if uerr, ok := err.(*url.Error); !ok || uerr.Err != ErrNoFixture {
+		t.Errorf("expected ErrNoFixture for unrecorded request, got %v", err)
+	}
+}
+
+// TestFixtureRecordMissing ...
+// Ensures only requests without a fixture reach the server
+func TestFixtureRecordMissing(t *testing.T) {
+	dir := tempDir()
+	defer os.RemoveAll(dir)
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fmt.Fprint(w, "<html><head><title>t</title></head></html>")
+	}))
+	defer srv.Close()
+
+	sched := NewScheduler()
+	sched.Client = &http.Client{Transport: &FixtureTransport{Dir: dir, Mode: FixtureRecordMissing}}
+	panicCheck(sched.Add(Job{Name: "titles", URL: srv.URL, Schedule: "@hourly",
+		Extract: func(s *Stew) (interface{}, error) {
+			return len(s.FindAll("title")), nil
+		}}))
+	for i := 0; i < 3; i++ {
+		r, ok := sched.RunNow("titles")
+		if !ok || r.Err != nil || r.Payload != 1 {
+			t.Errorf("run %d: expected 1 title, got %v (%v)", i, r.Payload, r.Err)
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("expected 1 request to reach the server, got %d", got)
+	}
+}
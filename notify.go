@@ -0,0 +1,168 @@
+//// file: notify.go
+
+package stew
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// =============================================
+//                    Declarations
+// =============================================
+
+// ErrNotifierFull is returned when a ChanNotifier has no room for an event
+var ErrNotifierFull = errors.New("stew: notifier channel is full")
+
+// ErrNotifyTimeout is reported when a notifier outlives its delivery deadline
+var ErrNotifyTimeout = errors.New("stew: notifier timed out")
+
+// defaultNotifyTimeout bounds webhook requests and scheduler deliveries
+// when no other timeout applies
+const defaultNotifyTimeout = 10 * time.Second
+
+// Event ...
+// Is a notification that a scrape job completed
+type Event struct {
+	Job  string    `json:"job"`
+	Time time.Time `json:"time"`
+	// Changed is true when the payload differs from the job's last successful run
+	Changed bool `json:"changed"`
+	// Payload is the extracted payload encoded as JSON
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Notifier ...
+// Is a sink for extraction events
+type Notifier interface {
+	Notify(Event) error
+}
+
+// WebhookNotifier ...
+// POSTs each event as a JSON body to URL
+type WebhookNotifier struct {
+	URL string
+	// Header is added to every request, e.g. for authorization
+	Header http.Header
+	// Client sends the requests, http.DefaultClient if nil
+	Client *http.Client
+	// Timeout bounds each request, defaultNotifyTimeout if zero
+	Timeout time.Duration
+}
+
+// ChanNotifier ...
+// Delivers events on a channel without blocking the job
+type ChanNotifier chan<- Event
+
+// =============================================
+//                    Public
+// =============================================
+
+// Notify ...
+// Sends event to the webhook, failing on non-2xx responses or timeout
+func (this *WebhookNotifier) Notify(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, this.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, vals := range this.Header {
+		req.Header[key] = vals
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	timeout := this.Timeout
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	client := this.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("stew: webhook %s responded %s", this.URL, resp.Status)
+	}
+	return nil
+}
+
+// Notify ...
+// Sends event on the channel, dropping it if the channel is full
+func (this ChanNotifier) Notify(event Event) error {
+	select {
+	case this <- event:
+		return nil
+	default:
+		return ErrNotifierFull
+	}
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+// notify converts result to an Event and sends it to every notifier.
+// Each delivery is abandoned after the job's Timeout (defaultNotifyTimeout
+// if unset) or once stop closes, so a dead sink cannot wedge the job loop
+func (this *Scheduler) notify(sj *scheduledJob, result Result, stop <-chan struct{}) {
+	event := Event{Job: result.Job, Time: result.End}
+	if result.Err != nil {
+		event.Error = result.Err.Error()
+	} else if payload, err := json.Marshal(result.Payload); err != nil {
+		event.Error = err.Error()
+	} else {
+		event.Payload = payload
+		this.mu.Lock()
+		event.Changed = !bytes.Equal(sj.last, payload)
+		sj.last = payload
+		this.mu.Unlock()
+	}
+
+	timeout := sj.Timeout
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	for _, notifier := range this.Notifiers {
+		err := deliver(notifier, event, timeout, stop)
+		if err != nil && this.OnNotifyError != nil {
+			this.OnNotifyError(event, err)
+		}
+	}
+}
+
+// deliver runs notifier in its own goroutine, giving up after timeout or stop
+func deliver(notifier Notifier, event Event, timeout time.Duration, stop <-chan struct{}) error {
+	done := make(chan error, 1) // buffered so an abandoned delivery can still finish
+	go func() {
+		done <- notifier.Notify(event)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrNotifyTimeout
+	case <-stop:
+		return ErrNotifyTimeout
+	}
+}
@@ -0,0 +1,191 @@
+//// file: notify_test.go
+
+package stew
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// =============================================
+//                    Tests
+// =============================================
+
+// TestWebhookNotifier ...
+// Validates events are posted as JSON with configured headers
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- event
+	}))
+	defer srv.Close()
+
+	hook := &WebhookNotifier{URL: srv.URL,
+		Header: http.Header{"Authorization": {"Bearer token"}}}
+	sent := Event{Job: "prices", Changed: true, Payload: json.RawMessage(`{"price":3}`)}
+	if err := hook.Notify(sent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := <-received
+	if got.Job != sent.Job || !got.Changed || string(got.Payload) != string(sent.Payload) {
+		t.Errorf("expected event %+v, got %+v", sent, got)
+	}
+
+	unauthorized := &WebhookNotifier{URL: srv.URL}
+	if err := unauthorized.Notify(sent); err == nil {
+		t.Errorf("expected error on non-2xx response")
+	}
+}
+
+// TestWebhookNotifierTimeout ...
+// Ensures webhook requests to unresponsive servers time out
+func TestWebhookNotifierTimeout(t *testing.T) {
+	srv, release := hangingServer()
+	defer srv.Close()
+	defer close(release)
+
+	hook := &WebhookNotifier{URL: srv.URL, Timeout: 20 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() { done <- hook.Notify(Event{Job: "prices"}) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected timeout error from unresponsive webhook")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("webhook request never timed out")
+	}
+}
+
+// TestChanNotifier ...
+// Ensures ChanNotifier never blocks
+func TestChanNotifier(t *testing.T) {
+	events := make(chan Event, 1)
+	notifier := ChanNotifier(events)
+	if err := notifier.Notify(Event{Job: "first"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := notifier.Notify(Event{Job: "second"}); err != ErrNotifierFull {
+		t.Errorf("expected ErrNotifierFull, got %v", err)
+	}
+	if got := <-events; got.Job != "first" {
+		t.Errorf("expected first event, got %s", got.Job)
+	}
+}
+
+// TestSchedulerNotify ...
+// Validates scheduled runs notify with change detection
+func TestSchedulerNotify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><head><title>sample title</title></head></html>")
+	}))
+	defer srv.Close()
+
+	events := make(chan Event, 2)
+	sched := NewScheduler()
+	sched.Notifiers = []Notifier{ChanNotifier(events)}
+	panicCheck(sched.Add(Job{Name: "title", URL: srv.URL, Schedule: "@every 5ms",
+		Extract: func(s *Stew) (interface{}, error) {
+			return map[string]int{"titles": len(s.FindAll("title"))}, nil
+		}}))
+	sched.Start()
+	defer sched.Stop()
+
+	var got []Event
+	timeout := time.After(time.Second)
+	for len(got) < 2 {
+		select {
+		case event := <-events:
+			got = append(got, event)
+		case <-timeout:
+			t.Fatalf("expected 2 events, got %d", len(got))
+		}
+	}
+	sched.Stop()
+
+	if string(got[0].Payload) != `{"titles":1}` {
+		t.Errorf("expected payload %s, got %s", `{"titles":1}`, got[0].Payload)
+	}
+	if !got[0].Changed {
+		t.Errorf("expected first payload to be a change")
+	}
+	if got[1].Changed {
+		t.Errorf("expected repeated payload not to be a change")
+	}
+}
+
+// TestSchedulerNotifyDeadSink ...
+// Ensures an unresponsive notifier wedges neither the job loop nor Stop
+func TestSchedulerNotifyDeadSink(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer page.Close()
+	hook, release := hangingServer()
+	defer hook.Close()
+	defer close(release)
+
+	failures := make(chan error, 16)
+	sched := NewScheduler()
+	sched.Notifiers = []Notifier{&WebhookNotifier{URL: hook.URL}}
+	sched.OnNotifyError = func(_ Event, err error) {
+		select {
+		case failures <- err:
+		default:
+		}
+	}
+	panicCheck(sched.Add(Job{Name: "dead", URL: page.URL, Schedule: "@every 5ms",
+		Timeout: 20 * time.Millisecond,
+		Extract: func(*Stew) (interface{}, error) { return nil, nil }}))
+	sched.Start()
+	defer sched.Stop()
+
+	// the job loop moves past a dead sink after the job timeout
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-failures:
+			if err != ErrNotifyTimeout {
+				t.Errorf("expected ErrNotifyTimeout, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected repeated delivery timeouts, got %d", i)
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		sched.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("Stop blocked on an unresponsive notifier")
+	}
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+// hangingServer never responds until release is closed
+func hangingServer() (*httptest.Server, chan struct{}) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	return srv, release
+}
@@ -0,0 +1,126 @@
+//// file: position.go
+
+package stew
+
+import "sort"
+
+// =============================================
+//                    Declarations
+// =============================================
+
+// docIndex numbers a Stew subtree in document (pre-)order.
+// Unlike Pos, which is breadth-first, document order follows the source
+type docIndex struct {
+	order []*Stew
+	index map[*Stew]int
+	// size of each node's subtree including itself, by document index
+	size []int
+}
+
+// =============================================
+//                    Public
+// =============================================
+
+// Between ...
+// Returns the largest subtrees lying entirely after start and before end
+// in document order, in document order. Ancestors of end are descended
+// into rather than returned. A nil start or end leaves that side open.
+// Returns nothing if start or end is outside this tree or end precedes start
+func (this *Stew) Between(start, end *Stew) []*Stew {
+	doc := newDocIndex(this)
+	from, to := 0, len(doc.order)
+	if start != nil {
+		i, ok := doc.index[start]
+		if !ok {
+			return []*Stew{}
+		}
+		from = i + doc.size[i]
+	}
+	if end != nil {
+		i, ok := doc.index[end]
+		if !ok {
+			return []*Stew{}
+		}
+		to = i
+	}
+
+	results := []*Stew{}
+	for i := from; i < to; {
+		if i+doc.size[i] <= to {
+			results = append(results, doc.order[i])
+			i += doc.size[i] // skip descendants of a whole subtree
+		} else {
+			i++ // an ancestor of end, look inside
+		}
+	}
+	return results
+}
+
+// After ...
+// Returns the largest subtrees following node in document order
+func (this *Stew) After(node *Stew) []*Stew {
+	return this.Between(node, nil)
+}
+
+// Before ...
+// Returns the largest subtrees preceding node in document order,
+// excluding node's ancestors
+func (this *Stew) Before(node *Stew) []*Stew {
+	return this.Between(nil, node)
+}
+
+// Next ...
+// Returns the first node after node's subtree in document order
+// matching input tags, or nil if there is none
+func (this *Stew) Next(node *Stew, tags ...string) *Stew {
+	doc := newDocIndex(this)
+	i, ok := doc.index[node]
+	if !ok {
+		return nil
+	}
+	for _, candidate := range doc.order[i+doc.size[i]:] {
+		for _, tag := range tags {
+			if candidate.Tag == tag {
+				return candidate
+			}
+		}
+	}
+	return nil
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+// sort orders indexed nodes by document order in place
+func (this *docIndex) sort(stews []*Stew) []*Stew {
+	sort.Slice(stews, func(i, j int) bool {
+		return this.index[stews[i]] < this.index[stews[j]]
+	})
+	return stews
+}
+
+// newDocIndex walks root depth-first without recursion
+func newDocIndex(root *Stew) *docIndex {
+	doc := &docIndex{index: make(map[*Stew]int)}
+	stack := []*Stew{root}
+	for len(stack) > 0 {
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		doc.index[curr] = len(doc.order)
+		doc.order = append(doc.order, curr)
+		for i := len(curr.Children) - 1; i >= 0; i-- {
+			stack = append(stack, curr.Children[i])
+		}
+	}
+
+	// accumulate sizes bottom up, children always follow their parent
+	doc.size = make([]int, len(doc.order))
+	for i := len(doc.order) - 1; i >= 0; i-- {
+		doc.size[i]++
+		if parent := doc.order[i].Parent; parent != nil && doc.order[i] != root {
+			doc.size[doc.index[parent]] += doc.size[i]
+		}
+	}
+	return doc
+}
@@ -0,0 +1,87 @@
+//// file: position_test.go
+
+package stew
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/mingkaic/gardener"
+)
+
+// =============================================
+//                    Globals
+// =============================================
+
+const sectionHTML = `<html><body>
+<h2>Intro</h2><p>a</p>
+<h2>Details</h2><p>b</p><ul><li>c</li><li>d</li></ul>
+<div><p>e</p><h2>Notes</h2><p>f</p></div>
+</body></html>`
+
+// =============================================
+//                    Tests
+// =============================================
+
+// TestBetween ...
+// Validates section-scoped extraction between headings
+func TestBetween(t *testing.T) {
+	var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(sectionHTML)}
+	stewie := NewFromReader(rc)
+	details := stewie.Find("", "Details")[0]
+	notes := stewie.Find("", "Notes")[0]
+
+	next := stewie.Next(details, "h2")
+	if next != notes {
+		t.Fatalf("expecting Notes heading after Details, got %v", describe(next))
+	}
+	// the div holding Notes is descended into rather than returned
+	expect := []string{"p b", "ul", "p e"}
+	if got := describeAll(stewie.Between(details, next)); !reflect.DeepEqual(expect, got) {
+		t.Errorf("expecting section %v, got %v", expect, got)
+	}
+
+	expect = []string{"p f"}
+	if got := describeAll(stewie.After(notes)); !reflect.DeepEqual(expect, got) {
+		t.Errorf("expecting after Notes %v, got %v", expect, got)
+	}
+	expect = []string{"head", "h2 Intro", "p a"}
+	if got := describeAll(stewie.Before(details)); !reflect.DeepEqual(expect, got) {
+		t.Errorf("expecting before Details %v, got %v", expect, got)
+	}
+
+	if got := stewie.Between(notes, details); len(got) > 0 {
+		t.Errorf("expecting nothing between reversed bounds, got %v", describeAll(got))
+	}
+	if got := stewie.Next(notes, "h2"); got != nil {
+		t.Errorf("expecting no heading after Notes, got %s", describe(got))
+	}
+	ul := stewie.FindAll("ul")[0]
+	if got := ul.After(details); len(got) > 0 {
+		t.Errorf("expecting nothing for node outside scope, got %v", describeAll(got))
+	}
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+func describe(s *Stew) string {
+	if s == nil {
+		return "<nil>"
+	}
+	if text := s.Attrs[""]; len(text) > 0 {
+		return s.Tag + " " + text[0]
+	}
+	return s.Tag
+}
+
+func describeAll(stews []*Stew) []string {
+	out := []string{}
+	for _, s := range stews {
+		out = append(out, describe(s))
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+//// file: project.go
+
+package stew
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// =============================================
+//                    Declarations
+// =============================================
+
+// Selector ...
+// Is a functor type for Stew-tree queries
+type Selector func(*Stew) []*Stew
+
+// Field ...
+// Describes how one named value is projected out of a container node
+type Field struct {
+	// Sel selects nodes under the container, nil selects the container itself
+	Sel Selector
+	// Attr is the attribute to read, empty string reads the text content
+	Attr string
+	// All collects every match into a list instead of keeping the first
+	All bool
+}
+
+// =============================================
+//                    Public
+// =============================================
+
+// SelectTags ...
+// Returns Selector matching input tags, like Stew.FindAll
+func SelectTags(tags ...string) Selector {
+	return func(root *Stew) []*Stew {
+		return root.FindAll(tags...)
+	}
+}
+
+// SelectAttr ...
+// Returns Selector matching input attr key-val pair, like Stew.Find
+func SelectAttr(attrKey, attrVal string) Selector {
+	return func(root *Stew) []*Stew {
+		return root.Find(attrKey, attrVal)
+	}
+}
+
+// Project ...
+// Maps each node matched by container to an object of named fields.
+// Containers and matches are in document order; missing fields are nil
+func (this *Stew) Project(container Selector, fields map[string]Field) []map[string]interface{} {
+	doc := newDocIndex(this)
+	containers := doc.sort(container(this))
+	results := make([]map[string]interface{}, len(containers))
+	for i, c := range containers {
+		obj := make(map[string]interface{}, len(fields))
+		for name, field := range fields {
+			obj[name] = field.project(c, doc)
+		}
+		results[i] = obj
+	}
+	return results
+}
+
+// ProjectJSON ...
+// Returns Project results encoded as a JSON array
+func (this *Stew) ProjectJSON(container Selector, fields map[string]Field) ([]byte, error) {
+	return json.Marshal(this.Project(container, fields))
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+// project extracts the field value from container c,
+// ordering matches with the document index of the projected tree
+func (this Field) project(c *Stew, doc *docIndex) interface{} {
+	matches := []*Stew{c}
+	if this.Sel != nil {
+		matches = doc.sort(this.Sel(c))
+	}
+
+	if this.All {
+		values := []string{}
+		for _, m := range matches {
+			if val, ok := m.value(this.Attr); ok {
+				values = append(values, val)
+			}
+		}
+		return values
+	}
+	for _, m := range matches {
+		if val, ok := m.value(this.Attr); ok {
+			return val
+		}
+	}
+	return nil
+}
+
+// value reads attribute attr, joining multiple text nodes with spaces
+func (this *Stew) value(attr string) (string, bool) {
+	vals, ok := this.Attrs[attr]
+	if !ok || len(vals) == 0 {
+		return "", false
+	}
+	if attr == "" {
+		return strings.Join(vals, " "), true
+	}
+	return vals[0], true
+}
@@ -0,0 +1,78 @@
+//// file: project_test.go
+
+package stew
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/mingkaic/gardener"
+)
+
+// =============================================
+//                    Globals
+// =============================================
+
+const cardsHTML = `<html><body>
+<div class="card"><h3>First</h3><span class="price">$3</span>
+	<a href="/first">more</a><span class="tag">a</span><span class="tag">b</span></div>
+<div class="card"><h3>Second</h3><a href="/second">more</a></div>
+<div class="ad"><h3>Buy now</h3></div>
+</body></html>`
+
+// =============================================
+//                    Tests
+// =============================================
+
+// TestProject ...
+// Validates Stew.Project maps each container to its named fields
+func TestProject(t *testing.T) {
+	var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(cardsHTML)}
+	stewie := NewFromReader(rc)
+
+	fields := map[string]Field{
+		"title": {Sel: SelectTags("h3")},
+		"price": {Sel: SelectAttr("class", "price")},
+		"url":   {Sel: SelectTags("a"), Attr: "href"},
+		"tags":  {Sel: SelectAttr("class", "tag"), All: true},
+		"class": {Attr: "class"},
+	}
+	expect := []map[string]interface{}{
+		{"title": "First", "price": "$3", "url": "/first",
+			"tags": []string{"a", "b"}, "class": "card"},
+		{"title": "Second", "price": nil, "url": "/second",
+			"tags": []string{}, "class": "card"},
+	}
+	got := stewie.Project(SelectAttr("class", "card"), fields)
+	if !reflect.DeepEqual(expect, got) {
+		t.Errorf("expected projection %v, got %v", expect, got)
+	}
+
+	raw, err := stewie.ProjectJSON(SelectAttr("class", "card"),
+		map[string]Field{"title": {Sel: SelectTags("h3")}})
+	panicCheck(err)
+	expectJSON := `[{"title":"First"},{"title":"Second"}]`
+	if string(raw) != expectJSON {
+		t.Errorf("expected json %s, got %s", expectJSON, raw)
+	}
+}
+
+// TestProjectOrder ...
+// Validates containers and fields at different depths come back in page order
+func TestProjectOrder(t *testing.T) {
+	const nestedCards = `<html><body>
+		<section><div class="card"><p><b>A</b></p><b>A2</b></div></section>
+		<div class="card"><b>B</b></div></body></html>`
+	var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(nestedCards)}
+	stewie := NewFromReader(rc)
+
+	raw, err := stewie.ProjectJSON(SelectAttr("class", "card"),
+		map[string]Field{"t": {Sel: SelectTags("b")}})
+	panicCheck(err)
+	expectJSON := `[{"t":"A"},{"t":"B"}]`
+	if string(raw) != expectJSON {
+		t.Errorf("expected json %s, got %s", expectJSON, raw)
+	}
+}
@@ -0,0 +1,464 @@
+//// file: scheduler.go
+
+package stew
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================
+//                    Declarations
+// =============================================
+
+// ErrJobExists is returned when adding a job whose name is already scheduled
+var ErrJobExists = errors.New("stew: job already scheduled")
+
+// ErrJobRunning is reported for scheduled runs skipped because the
+// previous run, or its abandoned extractor, has not returned yet
+var ErrJobRunning = errors.New("stew: job still running")
+
+// Extractor ...
+// Is a functor pulling a payload out of a scraped Stew tree
+type Extractor func(*Stew) (interface{}, error)
+
+// Schedule ...
+// Reports the next activation strictly after input time
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// Job ...
+// Is a named scrape of a single URL run on a recurring schedule
+type Job struct {
+	// Name uniquely identifies the job within its Scheduler
+	Name string
+	// URL is fetched on every run
+	URL string
+	// Schedule is a 5 field cron expression (minute hour dom month dow)
+	// or one of @hourly, @daily, @weekly, @monthly, @yearly, @every <duration>
+	Schedule string
+	// Timeout bounds fetching and extraction, zero means no limit.
+	// An extractor still running past it keeps later runs skipped
+	Timeout time.Duration
+	// Extract turns the scraped tree into the job's payload
+	Extract Extractor
+}
+
+// Result ...
+// Is the outcome of a single job run
+type Result struct {
+	Job     string
+	Start   time.Time
+	End     time.Time
+	Payload interface{}
+	Err     error
+}
+
+// Scheduler ...
+// Runs named scrape jobs on their schedules, never overlapping
+// two runs of the same job
+type Scheduler struct {
+	// Client fetches job URLs, http.DefaultClient if nil
+	Client *http.Client
+	// OnResult receives every completed run, and ErrJobRunning for skipped runs,
+	// called from the job's goroutine
+	OnResult func(Result)
+	// Notifiers are sent an Event after every completed run,
+	// each delivery bounded by the job's Timeout
+	Notifiers []Notifier
+	// OnNotifyError receives failed notifier deliveries
+	OnNotifyError func(Event, error)
+
+	mu      sync.Mutex
+	jobs    map[string]*scheduledJob
+	started bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type scheduledJob struct {
+	Job
+	sched   Schedule
+	running bool // guarded by Scheduler.mu
+	cancel  chan struct{}
+	// JSON of the last successful payload, for change detection
+	last []byte
+}
+
+// cron field bounds
+type cronField struct {
+	min, max uint
+}
+
+var cronFields = [5]cronField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 7},  // day of week, 0 and 7 are both sunday
+}
+
+// cronSchedule stores allowed values of each field as bitsets
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// day of month and week are OR-ed when both are restricted
+	domStar, dowStar bool
+}
+
+type everySchedule time.Duration
+
+// =============================================
+//                    Public
+// =============================================
+
+// ParseSchedule ...
+// Parses cron expressions and @ descriptors into a Schedule.
+// Rejects cron expressions that never fire, such as February 30th
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@yearly", "@annually":
+		spec = "0 0 1 1 *"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@hourly":
+		spec = "0 * * * *"
+	}
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("stew: bad schedule %q: %v", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("stew: bad schedule %q: non-positive interval", spec)
+		}
+		return everySchedule(d), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("stew: bad schedule %q: expected %d fields, got %d",
+			spec, len(cronFields), len(fields))
+	}
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("stew: bad schedule %q: %v", spec, err)
+		}
+		bits[i] = b
+	}
+	// fold sunday-as-7 onto 0
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = (bits[4] | 1) &^ (1 << 7)
+	}
+	sched := &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*") || fields[2] == "?",
+		dowStar: strings.HasPrefix(fields[4], "*") || fields[4] == "?",
+	}
+	if sched.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("stew: bad schedule %q: never fires", spec)
+	}
+	return sched, nil
+}
+
+// NewScheduler ...
+// Returns an empty stopped Scheduler
+func NewScheduler() *Scheduler {
+	return &Scheduler{jobs: make(map[string]*scheduledJob)}
+}
+
+// Add ...
+// Registers job, starting its timer right away if the Scheduler is running
+func (this *Scheduler) Add(job Job) error {
+	if job.Name == "" {
+		return errors.New("stew: job has no name")
+	}
+	if job.Extract == nil {
+		return fmt.Errorf("stew: job %q has no extractor", job.Name)
+	}
+	sched, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if _, ok := this.jobs[job.Name]; ok {
+		return ErrJobExists
+	}
+	sj := &scheduledJob{Job: job, sched: sched, cancel: make(chan struct{})}
+	this.jobs[job.Name] = sj
+	if this.started {
+		this.spawn(sj)
+	}
+	return nil
+}
+
+// Remove ...
+// Unschedules the named job, letting an in-progress run finish
+func (this *Scheduler) Remove(name string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if sj, ok := this.jobs[name]; ok {
+		close(sj.cancel)
+		delete(this.jobs, name)
+	}
+}
+
+// Start ...
+// Begins running every registered job on its schedule
+func (this *Scheduler) Start() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.started {
+		return
+	}
+	this.started = true
+	this.stop = make(chan struct{})
+	for _, sj := range this.jobs {
+		this.spawn(sj)
+	}
+}
+
+// Stop ...
+// Halts all timers and waits for in-progress runs to finish
+func (this *Scheduler) Stop() {
+	this.mu.Lock()
+	if !this.started {
+		this.mu.Unlock()
+		return
+	}
+	this.started = false
+	close(this.stop)
+	this.mu.Unlock()
+	this.wg.Wait()
+}
+
+// RunNow ...
+// Runs the named job immediately, outside of its schedule.
+// The result is returned instead of reported to OnResult or Notifiers.
+// Returns false if the job is unknown or already running
+func (this *Scheduler) RunNow(name string) (Result, bool) {
+	this.mu.Lock()
+	sj, ok := this.jobs[name]
+	this.mu.Unlock()
+	if !ok {
+		return Result{}, false
+	}
+	return this.run(sj)
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+// Next ...
+// Returns the next matching minute after t, or zero time if none
+// exists within five years
+func (this *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if this.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !this.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if this.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if this.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (this *cronSchedule) matchDay(t time.Time) bool {
+	domOk := this.dom&(1<<uint(t.Day())) != 0
+	dowOk := this.dow&(1<<uint(t.Weekday())) != 0
+	if this.domStar || this.dowStar {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
+
+// Next ...
+// Returns t advanced by the interval
+func (this everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(this))
+}
+
+// parseCronField parses comma separated values, ranges and steps into a bitset
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := uint(1)
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || s == 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			step = uint(s)
+			part = part[:i]
+		}
+
+		lo, hi := bounds.min, bounds.max
+		if part != "*" && part != "?" {
+			rng := strings.SplitN(part, "-", 2)
+			v, err := strconv.ParseUint(rng[0], 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			lo, hi = uint(v), uint(v)
+			if len(rng) == 2 {
+				v, err = strconv.ParseUint(rng[1], 10, 8)
+				if err != nil {
+					return 0, fmt.Errorf("bad value %q", part)
+				}
+				hi = uint(v)
+			} else if step > 1 {
+				hi = bounds.max // "5/15" means from 5 onward
+			}
+		}
+		if lo < bounds.min || hi > bounds.max || lo > hi {
+			return 0, fmt.Errorf("%q out of range [%d, %d]", part, bounds.min, bounds.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// spawn starts the timer loop of input job, expects this.mu held
+func (this *Scheduler) spawn(sj *scheduledJob) {
+	stop := this.stop
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+		next := sj.sched.Next(time.Now())
+		for !next.IsZero() {
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-sj.cancel:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if result, ok := this.run(sj); ok {
+				this.report(sj, result, stop)
+			} else if this.OnResult != nil {
+				now := time.Now()
+				this.OnResult(Result{Job: sj.Name, Start: now, End: now, Err: ErrJobRunning})
+			}
+			next = sj.sched.Next(time.Now())
+		}
+	}()
+}
+
+// run fetches and extracts once, skipping if the job is still running.
+// On timeout the abandoned run keeps the job marked as running until it returns
+func (this *Scheduler) run(sj *scheduledJob) (Result, bool) {
+	this.mu.Lock()
+	if sj.running {
+		this.mu.Unlock()
+		return Result{}, false
+	}
+	sj.running = true
+	this.mu.Unlock()
+
+	ctx := context.Background()
+	cancel := func() {}
+	if sj.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, sj.Timeout)
+	}
+	defer cancel()
+
+	result := Result{Job: sj.Name, Start: time.Now()}
+	done := make(chan struct{})
+	go func() {
+		defer func() {
+			this.mu.Lock()
+			sj.running = false
+			this.mu.Unlock()
+			close(done)
+		}()
+		payload, err := this.scrape(ctx, sj)
+		result.Payload, result.Err = payload, err
+	}()
+
+	select {
+	case <-done:
+		result.End = time.Now()
+		return result, true
+	case <-ctx.Done():
+		return Result{Job: sj.Name, Start: result.Start, End: time.Now(), Err: ctx.Err()}, true
+	}
+}
+
+// report hands a scheduled run's result to OnResult and Notifiers
+func (this *Scheduler) report(sj *scheduledJob, result Result, stop <-chan struct{}) {
+	if this.OnResult != nil {
+		this.OnResult(result)
+	}
+	if len(this.Notifiers) > 0 {
+		this.notify(sj, result, stop)
+	}
+}
+
+// scrape fetches the job URL and applies its extractor, recovering extractor panics
+func (this *Scheduler) scrape(ctx context.Context, sj *scheduledJob) (payload interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("stew: job %q panicked: %v", sj.Name, r)
+		}
+	}()
+	client := this.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest(http.MethodGet, sj.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("stew: job %q got status %s", sj.Name, resp.Status)
+	}
+	stew := NewFromRes(resp)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return sj.Extract(stew)
+}
@@ -0,0 +1,204 @@
+//// file: scheduler_test.go
+
+package stew
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// =============================================
+//                    Tests
+// =============================================
+
+// TestParseSchedule ...
+// Validates cron expression activation times
+func TestParseSchedule(t *testing.T) {
+	base := time.Date(2018, time.March, 14, 10, 7, 30, 0, time.UTC) // a wednesday
+	expectations := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2018, time.March, 14, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2018, time.March, 14, 10, 15, 0, 0, time.UTC)},
+		{"5 9-17 * * *", time.Date(2018, time.March, 14, 11, 5, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2018, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		{"30 8 * * 7", time.Date(2018, time.March, 18, 8, 30, 0, 0, time.UTC)},
+		{"0 12 1 * 1", time.Date(2018, time.March, 19, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2018, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", base.Add(90 * time.Second)},
+	}
+	for _, exp := range expectations {
+		sched, err := ParseSchedule(exp.spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", exp.spec, err)
+			continue
+		}
+		if got := sched.Next(base); !got.Equal(exp.next) {
+			t.Errorf("%q: expected %v, got %v", exp.spec, exp.next, got)
+		}
+	}
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* * 0 * *",
+		"*/0 * * * *", "5-1 * * * *", "@every -1s", "@fortnightly", "0 0 30 2 *"} {
+		if _, err := ParseSchedule(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+// TestSchedulerRun ...
+// Validates scheduled jobs fetch, extract and report results
+func TestSchedulerRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><head><title>sample title</title></head></html>")
+	}))
+	defer srv.Close()
+
+	results := make(chan Result, 16)
+	sched := NewScheduler()
+	sched.OnResult = func(r Result) {
+		select {
+		case results <- r:
+		default:
+		}
+	}
+	err := sched.Add(Job{Name: "title", URL: srv.URL, Schedule: "@every 5ms",
+		Extract: func(s *Stew) (interface{}, error) {
+			for _, title := range s.FindAll("title") {
+				return title.Attrs[""][0], nil
+			}
+			return nil, nil
+		}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sched.Add(Job{Name: "title", URL: srv.URL, Schedule: "@hourly",
+		Extract: func(*Stew) (interface{}, error) { return nil, nil }}); err != ErrJobExists {
+		t.Errorf("expected ErrJobExists, got %v", err)
+	}
+	sched.Start()
+	defer sched.Stop()
+
+	select {
+	case r := <-results:
+		if r.Err != nil {
+			t.Errorf("unexpected job error: %v", r.Err)
+		}
+		if r.Payload != "sample title" {
+			t.Errorf("expected payload %q, got %v", "sample title", r.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("job never ran")
+	}
+}
+
+// TestSchedulerOverlap ...
+// Ensures runs of a job never overlap and are bounded by the job timeout
+func TestSchedulerOverlap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer srv.Close()
+
+	sched := NewScheduler()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	exited := make(chan struct{})
+	panicCheck(sched.Add(Job{Name: "slow", URL: srv.URL, Schedule: "@hourly",
+		Timeout: 50 * time.Millisecond,
+		Extract: func(*Stew) (interface{}, error) {
+			defer close(exited)
+			close(entered)
+			<-release
+			return nil, nil
+		}}))
+
+	first := make(chan Result, 1)
+	go func() {
+		r, ok := sched.RunNow("slow")
+		if !ok {
+			t.Errorf("expected first run to start")
+		}
+		first <- r
+	}()
+	select {
+	case <-entered:
+	case r := <-first:
+		t.Fatalf("expected extractor to start, run ended with %v", r.Err)
+	case <-time.After(time.Second):
+		t.Fatalf("extractor never started")
+	}
+	if _, ok := sched.RunNow("slow"); ok {
+		t.Errorf("expected overlapping run to be skipped")
+	}
+
+	select {
+	case r := <-first:
+		if r.Err != context.DeadlineExceeded {
+			t.Errorf("expected deadline exceeded, got %v", r.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("first run never timed out")
+	}
+	// the timed out extractor is still blocked, so the job is still running
+	if _, ok := sched.RunNow("slow"); ok {
+		t.Errorf("expected run with abandoned extractor to be skipped")
+	}
+	close(release)
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatalf("extractor never returned")
+	}
+
+	if _, ok := sched.RunNow("missing"); ok {
+		t.Errorf("expected unknown job to be skipped")
+	}
+}
+
+// TestSchedulerSkipped ...
+// Validates scheduled runs skipped behind a hung extractor are reported
+func TestSchedulerSkipped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer srv.Close()
+	release := make(chan struct{})
+	defer close(release)
+
+	results := make(chan Result, 16)
+	sched := NewScheduler()
+	sched.OnResult = func(r Result) {
+		select {
+		case results <- r:
+		default:
+		}
+	}
+	panicCheck(sched.Add(Job{Name: "hung", URL: srv.URL, Schedule: "@every 5ms",
+		Timeout: 10 * time.Millisecond,
+		Extract: func(*Stew) (interface{}, error) {
+			<-release
+			return nil, nil
+		}}))
+	sched.Start()
+	defer sched.Stop()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case r := <-results:
+			if r.Err == ErrJobRunning {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("expected skipped runs to report ErrJobRunning")
+		}
+	}
+}
@@ -5,11 +5,13 @@
 package stew
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"strings"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 	"gopkg.in/eapache/queue.v1"
 )
 
@@ -35,67 +37,168 @@ type Stew struct {
 	// Attrs ... map attribute key to value
 	// empty string attrs key is the text content
 	Attrs map[string][]string
+	// AttrOrder lists attribute keys in declaration order without repeats
+	AttrOrder []string
+	// AttrCount maps attribute key to the number of times it was declared
+	AttrCount map[string]uint
+	// EscapedText is the text content in canonical escaped form, see TextBoth
+	EscapedText []string
+	// Fragments maps attribute key to trees re-parsed from embedded html,
+	// see ParseEmbedded. Fragment roots have this node as Parent
+	Fragments map[string][]*Stew
+}
+
+// TextMode ...
+// Selects how character references appear in extracted text
+type TextMode int
+
+const (
+	// TextDecoded stores text with references decoded, the default
+	TextDecoded TextMode = iota
+	// TextCanonical stores text with only &, < and > escaped.
+	// The parser does not keep the source spelling of references,
+	// so this is a canonical escaped form rather than the original bytes.
+	// Raw text such as script and style bodies is kept as is
+	TextCanonical
+	// TextBoth stores decoded text in Attrs[""] and canonical text in EscapedText
+	TextBoth
+)
+
+// escapes the characters that cannot appear literally in html text
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Option ...
+// Is a functor configuring Stew tree construction
+type Option func(*config)
+
+// construction settings collected from Options
+type config struct {
+	dropDupAttrs bool
+	subtrees     NodeFilter
+	textMode     TextMode
+	noscript     bool
 }
 
 // ElemLookup ...
 // Is a functor type for DOM-tree BFS
 type ElemLookup func(*html.Node) []*html.Node
 
-// functor determines whether input node is a target
-// and whether it terminates the DOM search
-type queryOpt func(*html.Node) bool
+// ContextLookup ...
+// Is a functor type for cancellable DOM-tree BFS,
+// returning partial results with the context error
+type ContextLookup func(context.Context, *html.Node) ([]*html.Node, error)
+
+// nodes visited between context checks in cancellable queries
+const ctxCheckInterval = 256
+
+// NodeFilter ...
+// Is a functor determining whether input node is a target
+type NodeFilter func(*html.Node) bool
 
 // =============================================
 //                    Public
 // =============================================
 
+//// Construction Options
+
+// DropDuplicateAttrs ...
+// Keeps only the first value of repeated attributes, as HTML does.
+// AttrCount still records every declaration
+func DropDuplicateAttrs() Option {
+	return func(cfg *config) {
+		cfg.dropDupAttrs = true
+	}
+}
+
+// OnlySubtrees ...
+// Materializes only subtrees rooted at elements matching filter,
+// attaching them directly under the root and discarding everything else
+func OnlySubtrees(filter NodeFilter) Option {
+	return func(cfg *config) {
+		cfg.subtrees = filter
+	}
+}
+
+// WithTextMode ...
+// Controls character reference decoding in extracted text.
+// Attribute values are always decoded, including numeric references
+func WithTextMode(mode TextMode) Option {
+	return func(cfg *config) {
+		cfg.textMode = mode
+	}
+}
+
+// ParseNoscript ...
+// Parses the contents of <noscript> elements into the tree
+// instead of keeping them as a single text node
+func ParseNoscript() Option {
+	return func(cfg *config) {
+		cfg.noscript = true
+	}
+}
+
 //// Creator & Members for Stew Node
 
 // New ...
 // Visits link and extracts the Stew tree representation of the static DOM
-func New(link string) *Stew {
+func New(link string, opts ...Option) *Stew {
 	resp, err := http.Get(link)
 	if err != nil {
 		panic(err)
 	}
-	return NewFromRes(resp)
+	return NewFromRes(resp, opts...)
 }
 
 // NewFromRes ...
 // Parses input response and returns the Stew tree root
-func NewFromRes(res *http.Response) *Stew {
-	return NewFromReader(res.Body)
+func NewFromRes(res *http.Response, opts ...Option) *Stew {
+	return NewFromReader(res.Body, opts...)
 }
 
 // NewFromReader ...
 // Parses input html reader source and returns the Stew tree root
-func NewFromReader(body io.ReadCloser) *Stew {
+func NewFromReader(body io.ReadCloser, opts ...Option) *Stew {
 	defer body.Close()
 	root, err := html.Parse(body)
 	if err != nil {
 		panic(err)
 	}
-	return NewFromNode(root)
+	return NewFromNode(root, opts...)
 }
 
 // NewFromNode ...
 // Traverses through input root node and returns the Stew tree root
-func NewFromNode(root *html.Node) *Stew {
+func NewFromNode(root *html.Node, opts ...Option) *Stew {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	// parse root
 	type nodePair struct {
 		h *html.Node
 		s *Stew
+		// inside is true within a subtree kept by cfg.subtrees
+		inside bool
 	}
 	downQueue := queue.New()
-	upQueue := queue.New()
-	upVisits := make(map[*Stew]uint)
 
-	// propagate down the tree collecting immediate descendants
+	// single breadth first pass, registering each node with all its ancestors
 	result := &Stew{Pos: 0, Tag: root.Data,
 		Descs: make(DescMap),
 		Attrs: make(map[string][]string)}
-	downQueue.Add(nodePair{root, result})
+	downQueue.Add(nodePair{root, result, cfg.subtrees == nil})
 	var pos uint = 1
+	attach := func(sNode *Stew, child *html.Node) {
+		sChild := &Stew{Pos: pos, Tag: child.Data,
+			Descs:  make(DescMap),
+			Attrs:  make(map[string][]string),
+			Parent: sNode}
+		pos++
+		sNode.Children = append(sNode.Children, sChild)
+		sNode.addDesc(sChild)
+		downQueue.Add(nodePair{child, sChild, true})
+	}
 
 	for downQueue.Length() > 0 {
 		curr := downQueue.Peek().(nodePair)
@@ -103,60 +206,25 @@ func NewFromNode(root *html.Node) *Stew {
 		hNode := curr.h
 		sNode := curr.s
 
-		for _, attr := range hNode.Attr {
-			sNode.Attrs[attr.Key] = append(sNode.Attrs[attr.Key], attr.Val)
-		}
-		for child := hNode.FirstChild; child != nil; child = child.NextSibling {
+		sNode.addAttrs(hNode.Attr, &cfg)
+		for child := firstChild(hNode, &cfg); child != nil; child = child.NextSibling {
 			switch child.Type {
 			case html.ElementNode:
-				upVisits[sNode]++
-				sChild := &Stew{Pos: pos, Tag: child.Data,
-					Descs:  make(DescMap),
-					Attrs:  make(map[string][]string),
-					Parent: sNode}
-				pos++
-				sNode.Children = append(sNode.Children, sChild)
-				descs, ok := sNode.Descs[child.Data]
-				if !ok {
-					descs = make(map[*Stew]struct{})
-					sNode.Descs[child.Data] = descs
+				if curr.inside || cfg.subtrees(child) {
+					attach(sNode, child)
+					continue
+				}
+				// skip child but attach subtrees kept below it in document order
+				for _, kept := range keptSubtrees(child, &cfg) {
+					attach(sNode, kept)
 				}
-				descs[sChild] = struct{}{}
-				downQueue.Add(nodePair{child, sChild})
 			case html.TextNode:
 				content := strings.TrimSpace(child.Data)
 				if len(content) > 0 {
-					sNode.Attrs[""] = append(sNode.Attrs[""], content)
+					sNode.addText(content, literalText(hNode, &cfg), &cfg)
 				}
 			}
 		}
-		if len(sNode.Descs) == 0 {
-			upQueue.Add(sNode) // add leaves
-		}
-	}
-
-	// propagate up the tree merging descendant maps
-	for upQueue.Length() > 0 {
-		curr := upQueue.Peek().(*Stew)
-		upQueue.Remove()
-		// push diff(curr.Desc, curr.Parent.Desc) to curr.Parent.Desc
-		for _, child := range curr.Children {
-			for key, value := range child.Descs {
-				if descs, ok := curr.Descs[key]; ok {
-					// merge value and descs
-					for v := range value {
-						descs[v] = struct{}{}
-					}
-				} else {
-					curr.Descs[key] = value
-				}
-			}
-		}
-
-		upVisits[curr.Parent]--
-		if curr.Parent != nil && upVisits[curr.Parent] == 0 {
-			upQueue.Add(curr.Parent)
-		}
 	}
 
 	return result
@@ -165,6 +233,16 @@ func NewFromNode(root *html.Node) *Stew {
 // FindAll ...
 // Returns all Stew nodes matching input tags
 func (this *Stew) FindAll(tags ...string) []*Stew {
+	results, _ := this.FindAllContext(context.Background(), tags...)
+	return results
+}
+
+// FindAllContext ...
+// Is FindAll stopping once ctx is done, returning partial results and ctx.Err()
+func (this *Stew) FindAllContext(ctx context.Context, tags ...string) ([]*Stew, error) {
+	if err := ctx.Err(); err != nil {
+		return []*Stew{}, err
+	}
 	stews := make(map[*Stew]struct{})
 	for _, tag := range tags {
 		if this.Tag == tag {
@@ -173,35 +251,56 @@ func (this *Stew) FindAll(tags ...string) []*Stew {
 		}
 	}
 
+	var err error
+	visited := 0
+search:
 	for _, tag := range tags {
 		if desc, ok := this.Descs[tag]; ok {
 			for v := range desc {
 				stews[v] = struct{}{}
+				if visited++; visited%ctxCheckInterval == 0 {
+					if err = ctx.Err(); err != nil {
+						break search
+					}
+				}
 			}
 		}
 	}
-	slist := make([]*Stew, 0, len(stews))
+	results := make([]*Stew, 0, len(stews))
 	for s := range stews {
-		slist = append(slist, s)
-	}
-	results := make([]*Stew, len(slist))
-	for i, tag := range slist {
-		results[i] = tag
+		results = append(results, s)
 	}
-	return results
+	return results, err
+}
+
+// Duplicated ...
+// Returns whether input attribute key was declared more than once
+func (this *Stew) Duplicated(attrKey string) bool {
+	return this.AttrCount[attrKey] > 1
 }
 
 // Find ...
 // Returns all Stew nodes with matching input attr key-val pair
 func (this *Stew) Find(attrKey, attrVal string) []*Stew {
+	results, _ := this.FindContext(context.Background(), attrKey, attrVal)
+	return results
+}
+
+// FindContext ...
+// Is Find stopping once ctx is done, returning partial results and ctx.Err()
+func (this *Stew) FindContext(ctx context.Context, attrKey, attrVal string) ([]*Stew, error) {
 	results := []*Stew{}
-	for _, attrVal := range this.Attrs[attrKey] {
-		if attrVal == attrVal {
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+	for _, val := range this.Attrs[attrKey] {
+		if val == attrVal {
 			results = append(results, this)
 			break
 		}
 	}
 
+	visited := 0
 	for _, stews := range this.Descs {
 		for s := range stews {
 			for _, val := range s.Attrs[attrKey] {
@@ -210,9 +309,14 @@ func (this *Stew) Find(attrKey, attrVal string) []*Stew {
 					break
 				}
 			}
+			if visited++; visited%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return results, err
+				}
+			}
 		}
 	}
-	return results
+	return results, nil
 }
 
 //// Quick Lookups
@@ -220,42 +324,203 @@ func (this *Stew) Find(attrKey, attrVal string) []*Stew {
 // FindAll ...
 // Returns functor looking for elements with input tags
 func FindAll(tags ...string) ElemLookup {
-	return generateLookup(
-		func(node *html.Node) bool {
-			isTarget := false
-			for _, tag := range tags {
-				isTarget = isTarget || node.Data == tag
-			}
-			return isTarget
-		})
+	return generateLookup(MatchTags(tags...))
 }
 
 // Find ...
 // Returns functor looking for elements matching input attr key-val pair
 func Find(attrKey, attrVal string) ElemLookup {
-	return generateLookup(
-		func(node *html.Node) bool {
-			for _, attr := range node.Attr {
-				if attr.Key == attrKey {
-					return attr.Val == attrVal
-				}
+	return generateLookup(MatchAttr(attrKey, attrVal))
+}
+
+// FindAllContext ...
+// Returns cancellable functor looking for elements with input tags
+func FindAllContext(tags ...string) ContextLookup {
+	return generateContextLookup(MatchTags(tags...))
+}
+
+// FindContext ...
+// Returns cancellable functor looking for elements matching input attr key-val pair
+func FindContext(attrKey, attrVal string) ContextLookup {
+	return generateContextLookup(MatchAttr(attrKey, attrVal))
+}
+
+// MatchTags ...
+// Returns filter accepting elements with input tags
+func MatchTags(tags ...string) NodeFilter {
+	return func(node *html.Node) bool {
+		isTarget := false
+		for _, tag := range tags {
+			isTarget = isTarget || node.Data == tag
+		}
+		return isTarget
+	}
+}
+
+// MatchAttr ...
+// Returns filter accepting elements matching input attr key-val pair
+func MatchAttr(attrKey, attrVal string) NodeFilter {
+	return func(node *html.Node) bool {
+		for _, attr := range node.Attr {
+			if attr.Key == attrKey {
+				return attr.Val == attrVal
 			}
-			return false
-		})
+		}
+		return false
+	}
 }
 
 // =============================================
 //                    Private
 // =============================================
 
+// registers desc in the Descs of this node and every ancestor
+func (this *Stew) addDesc(desc *Stew) {
+	for anc := this; anc != nil; anc = anc.Parent {
+		descs, ok := anc.Descs[desc.Tag]
+		if !ok {
+			descs = make(map[*Stew]struct{})
+			anc.Descs[desc.Tag] = descs
+		}
+		descs[desc] = struct{}{}
+	}
+}
+
+// records attributes in declaration order, counting repeated keys
+func (this *Stew) addAttrs(attrs []html.Attribute, cfg *config) {
+	if len(attrs) == 0 {
+		return
+	}
+	this.AttrCount = make(map[string]uint)
+	for _, attr := range attrs {
+		this.AttrCount[attr.Key]++
+		if this.AttrCount[attr.Key] == 1 {
+			this.AttrOrder = append(this.AttrOrder, attr.Key)
+		} else if cfg.dropDupAttrs {
+			continue
+		}
+		this.Attrs[attr.Key] = append(this.Attrs[attr.Key], attr.Val)
+	}
+}
+
+// records decoded text content according to the configured TextMode,
+// literal text has no character references and is never escaped
+func (this *Stew) addText(content string, literal bool, cfg *config) {
+	switch cfg.textMode {
+	case TextCanonical:
+		this.Attrs[""] = append(this.Attrs[""], canonicalText(content, literal))
+	case TextBoth:
+		this.Attrs[""] = append(this.Attrs[""], content)
+		this.EscapedText = append(this.EscapedText, canonicalText(content, literal))
+	default:
+		this.Attrs[""] = append(this.Attrs[""], content)
+	}
+}
+
+// returns content in canonical escaped form, leaving literal text alone
+func canonicalText(content string, literal bool) string {
+	if literal {
+		return content
+	}
+	return textEscaper.Replace(content)
+}
+
+// returns the first child of n to traverse, re-parsing noscript if configured
+func firstChild(n *html.Node, cfg *config) *html.Node {
+	if cfg.noscript && n.Type == html.ElementNode && n.DataAtom == atom.Noscript {
+		return parseNoscript(n)
+	}
+	return n.FirstChild
+}
+
+// searches below skipped element n depth first without recursion,
+// returning the outermost elements matching cfg.subtrees in document order
+func keptSubtrees(n *html.Node, cfg *config) []*html.Node {
+	kept := []*html.Node{}
+	stack := []*html.Node{n}
+	for len(stack) > 0 {
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if curr != n && cfg.subtrees(curr) {
+			kept = append(kept, curr)
+			continue
+		}
+		mark := len(stack)
+		for child := firstChild(curr, cfg); child != nil; child = child.NextSibling {
+			if child.Type == html.ElementNode {
+				stack = append(stack, child)
+			}
+		}
+		// reverse so the first child is popped first
+		for i, j := mark, len(stack)-1; i < j; i, j = i+1, j-1 {
+			stack[i], stack[j] = stack[j], stack[i]
+		}
+	}
+	return kept
+}
+
+// reports whether text children of n are raw source, as html.Render treats them.
+// Noscript is raw unless ParseNoscript re-parsed it
+func literalText(n *html.Node, cfg *config) bool {
+	if n.Type != html.ElementNode || n.Namespace != "" {
+		return false
+	}
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Xmp, atom.Iframe,
+		atom.Noembed, atom.Noframes, atom.Plaintext:
+		return true
+	case atom.Noscript:
+		return !cfg.noscript
+	}
+	return false
+}
+
+// re-parses noscript text content (as produced by a scripting parser)
+// in body context, returning the first of the parsed sibling nodes
+func parseNoscript(noscript *html.Node) *html.Node {
+	text := noscript.FirstChild
+	if text == nil || text.Type != html.TextNode || text.NextSibling != nil {
+		return noscript.FirstChild // empty or already parsed as markup
+	}
+	nodes, err := parseInBody(text.Data)
+	if err != nil {
+		return noscript.FirstChild
+	}
+	holder := &html.Node{Type: html.ElementNode, Data: noscript.Data, DataAtom: noscript.DataAtom}
+	for _, node := range nodes {
+		holder.AppendChild(node)
+	}
+	return holder.FirstChild
+}
+
+// parses an html fragment as if it appeared inside <body>
+func parseInBody(fragment string) ([]*html.Node, error) {
+	return html.ParseFragment(strings.NewReader(fragment),
+		&html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+}
+
 // generates a breadth first DOM search given a query functor
-func generateLookup(query queryOpt) ElemLookup {
+func generateLookup(query NodeFilter) ElemLookup {
+	lookup := generateContextLookup(query)
 	return func(root *html.Node) []*html.Node {
+		results, _ := lookup(context.Background(), root)
+		return results
+	}
+}
+
+// generates a cancellable breadth first DOM search given a query functor
+func generateContextLookup(query NodeFilter) ContextLookup {
+	return func(ctx context.Context, root *html.Node) ([]*html.Node, error) {
 		results := []*html.Node{}
 		queue := queue.New()
 		queue.Add(root)
 
-		for queue.Length() > 0 {
+		for visited := 0; queue.Length() > 0; visited++ {
+			if visited%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return results, err
+				}
+			}
 			curr := queue.Peek().(*html.Node)
 			queue.Remove()
 			if query(curr) {
@@ -267,6 +532,6 @@ func generateLookup(query queryOpt) ElemLookup {
 			}
 		}
 
-		return results
+		return results, nil
 	}
 }
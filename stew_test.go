@@ -4,6 +4,7 @@ package stew
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
 	"reflect"
@@ -21,6 +22,9 @@ import (
 const (
 	nTagGroup = 4
 	NTESTS    = 100
+
+	benchDepth = 400
+	benchWidth = 4000
 )
 
 var expectedPage *gardener.HTMLNode
@@ -179,6 +183,246 @@ func TestQuickFind(t *testing.T) {
 	}
 }
 
+// TestDuplicateAttrs ...
+// Validates attribute order and duplicate tracking
+func TestDuplicateAttrs(t *testing.T) {
+	const dupHTML = `<div id="x" class="a b" data-v="1" class="c" data-v="2"></div>`
+	var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(dupHTML)}
+	div := NewFromReader(rc).FindAll("div")[0]
+
+	expectOrder := []string{"id", "class", "data-v"}
+	if !reflect.DeepEqual(expectOrder, div.AttrOrder) {
+		t.Errorf("expecting attribute order %v, got %v", expectOrder, div.AttrOrder)
+	}
+	if div.Duplicated("id") || !div.Duplicated("class") || !div.Duplicated("data-v") {
+		t.Errorf("expecting only class and data-v duplicated, got counts %v", div.AttrCount)
+	}
+	expectClass := []string{"a b", "c"}
+	if !reflect.DeepEqual(expectClass, div.Attrs["class"]) {
+		t.Errorf("expecting class values %v, got %v", expectClass, div.Attrs["class"])
+	}
+
+	rc = &gardener.MockRC{bytes.NewBufferString(dupHTML)}
+	div = NewFromReader(rc, DropDuplicateAttrs()).FindAll("div")[0]
+	expectClass = []string{"a b"}
+	if !reflect.DeepEqual(expectClass, div.Attrs["class"]) {
+		t.Errorf("expecting first class value %v, got %v", expectClass, div.Attrs["class"])
+	}
+	if !div.Duplicated("class") {
+		t.Errorf("expecting class duplication to be recorded when dropped")
+	}
+}
+
+// TestOnlySubtrees ...
+// Validates filtered construction keeps only matching subtrees
+func TestOnlySubtrees(t *testing.T) {
+	const tableHTML = `<html><head><title>t</title></head><body>
+		<div><p>skipped</p><table id="prices"><tr><td>1</td><td>2</td></tr></table></div>
+		<table id="other"><tr><td>3</td></tr></table></body></html>`
+	var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(tableHTML)}
+	stewie := NewFromReader(rc, OnlySubtrees(MatchAttr("id", "prices")))
+
+	if len(stewie.Children) != 1 {
+		t.Fatalf("expecting 1 subtree under root, got %d", len(stewie.Children))
+	}
+	table := stewie.Children[0]
+	if table.Tag != "table" || table.Parent != stewie || table.Pos != 1 {
+		t.Errorf("expecting table at position 1 under root, got <%d %s>", table.Pos, table.Tag)
+	}
+	for _, tag := range []string{"html", "head", "title", "body", "div", "p"} {
+		if len(stewie.FindAll(tag)) > 0 {
+			t.Errorf("expecting %s to be discarded", tag)
+		}
+	}
+	if len(stewie.Attrs) > 0 {
+		t.Errorf("expecting skipped text to be discarded, got %v", stewie.Attrs)
+	}
+	cells := stewie.FindAll("td")
+	if len(cells) != 2 {
+		t.Errorf("expecting 2 cells in kept table, got %d", len(cells))
+	}
+	expectPos := []int{1, 2, 3, 4, 5}
+	gotPos := []int{}
+	for _, tag := range []string{"table", "tbody", "tr", "td"} {
+		for _, st := range stewie.FindAll(tag) {
+			gotPos = append(gotPos, int(st.Pos))
+		}
+	}
+	sort.Ints(gotPos)
+	if !reflect.DeepEqual(expectPos, gotPos) {
+		t.Errorf("expecting positions %v, got %v", expectPos, gotPos)
+	}
+
+	// kept subtrees are attached in document order regardless of depth
+	const nestedHTML = `<html><body><div><p>keep me</p></div><p>two</p></body></html>`
+	rc = &gardener.MockRC{bytes.NewBufferString(nestedHTML)}
+	stewie = NewFromReader(rc, OnlySubtrees(MatchTags("p")))
+	gotText := []string{}
+	for _, child := range stewie.Children {
+		gotText = append(gotText, child.Attrs[""]...)
+	}
+	if expectText := []string{"keep me", "two"}; !reflect.DeepEqual(expectText, gotText) {
+		t.Errorf("expecting subtrees in document order %q, got %q", expectText, gotText)
+	}
+	if stewie.Children[0].Pos != 1 || stewie.Children[1].Pos != 2 {
+		t.Errorf("expecting positions [1 2], got [%d %d]",
+			stewie.Children[0].Pos, stewie.Children[1].Pos)
+	}
+}
+
+// TestTextMode ...
+// Validates character reference handling in text and attribute values
+func TestTextMode(t *testing.T) {
+	const entityHTML = `<p title="it&#39;s &#x41;&#66 &#150; &amp;c">Tom &amp; Jerry &#60;3 &quot;it's&quot;</p>`
+	decoded := []string{`Tom & Jerry <3 "it's"`}
+	escaped := []string{`Tom &amp; Jerry &lt;3 "it's"`}
+	expectTitle := []string{"it's AB \u2013 &c"}
+
+	modes := []struct {
+		mode             TextMode
+		text, escapedTxt []string
+	}{
+		{TextDecoded, decoded, nil},
+		{TextCanonical, escaped, nil},
+		{TextBoth, decoded, escaped},
+	}
+	for _, m := range modes {
+		var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(entityHTML)}
+		p := NewFromReader(rc, WithTextMode(m.mode)).FindAll("p")[0]
+		if !reflect.DeepEqual(m.text, p.Attrs[""]) {
+			t.Errorf("mode %d: expecting text %q, got %q", m.mode, m.text, p.Attrs[""])
+		}
+		if !reflect.DeepEqual(m.escapedTxt, p.EscapedText) {
+			t.Errorf("mode %d: expecting escaped text %q, got %q", m.mode, m.escapedTxt, p.EscapedText)
+		}
+		if !reflect.DeepEqual(expectTitle, p.Attrs["title"]) {
+			t.Errorf("mode %d: expecting title %q, got %q", m.mode, expectTitle, p.Attrs["title"])
+		}
+	}
+
+	// raw text bodies have no references and are kept verbatim in every mode
+	const scriptHTML = `<script type="application/json">{"a":"<p>x</p> &amp;"}</script>`
+	raw := []string{`{"a":"<p>x</p> &amp;"}`}
+	for _, m := range modes {
+		var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(scriptHTML)}
+		script := NewFromReader(rc, WithTextMode(m.mode)).FindAll("script")[0]
+		if !reflect.DeepEqual(raw, script.Attrs[""]) {
+			t.Errorf("mode %d: expecting script text %q, got %q", m.mode, raw, script.Attrs[""])
+		}
+		if m.escapedTxt != nil && !reflect.DeepEqual(raw, script.EscapedText) {
+			t.Errorf("mode %d: expecting escaped script text %q, got %q", m.mode, raw, script.EscapedText)
+		}
+	}
+}
+
+// TestParseNoscript ...
+// Validates noscript contents become part of the tree
+func TestParseNoscript(t *testing.T) {
+	const noscriptHTML = `<html><body><noscript><img src="a.png"><p>no js</p></noscript></body></html>`
+	var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(noscriptHTML)}
+	stewie := NewFromReader(rc)
+	if len(stewie.FindAll("img")) > 0 {
+		t.Errorf("expecting noscript to stay opaque by default")
+	}
+
+	rc = &gardener.MockRC{bytes.NewBufferString(noscriptHTML)}
+	stewie = NewFromReader(rc, ParseNoscript())
+	noscript := stewie.FindAll("noscript")[0]
+	if len(noscript.Attrs[""]) > 0 {
+		t.Errorf("expecting noscript text to be parsed, got %v", noscript.Attrs[""])
+	}
+	imgs := stewie.Find("src", "a.png")
+	if len(imgs) != 1 || imgs[0].Tag != "img" || imgs[0].Parent != noscript {
+		t.Errorf("expecting img under noscript, got %v", imgs)
+	}
+	ps := noscript.FindAll("p")
+	if len(ps) != 1 || !reflect.DeepEqual([]string{"no js"}, ps[0].Attrs[""]) {
+		t.Errorf("expecting fallback paragraph under noscript, got %v", ps)
+	}
+}
+
+// TestFindContext ...
+// Validates cancellable queries return partial results with the ctx error
+func TestFindContext(t *testing.T) {
+	var page bytes.Buffer
+	page.WriteString("<html><body>")
+	for i := 0; i < 4*ctxCheckInterval; i++ {
+		page.WriteString(`<p class="x">x</p>`)
+	}
+	page.WriteString("</body></html>")
+	pageHTML := page.String()
+	var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(pageHTML)}
+	stewie := NewFromReader(rc)
+	total := 4 * ctxCheckInterval
+
+	if got, err := stewie.FindAllContext(context.Background(), "p"); err != nil || len(got) != total {
+		t.Errorf("expecting %d matches without error, got %d, %v", total, len(got), err)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got, err := stewie.FindContext(cancelled, "class", "x"); err != context.Canceled || len(got) > 0 {
+		t.Errorf("expecting no matches and context.Canceled, got %d, %v", len(got), err)
+	}
+
+	// contexts expiring mid-query keep what was found so far
+	got, err := stewie.FindAllContext(&countdownCtx{context.Background(), 2}, "p")
+	if err != context.Canceled || len(got) == 0 || len(got) >= total {
+		t.Errorf("expecting partial matches and context.Canceled, got %d, %v", len(got), err)
+	}
+	got, err = stewie.FindContext(&countdownCtx{context.Background(), 2}, "class", "x")
+	if err != context.Canceled || len(got) == 0 || len(got) >= total {
+		t.Errorf("expecting partial matches and context.Canceled, got %d, %v", len(got), err)
+	}
+
+	root, perr := html.Parse(bytes.NewBufferString(pageHTML))
+	panicCheck(perr)
+	nodes, err := FindAllContext("p")(&countdownCtx{context.Background(), 2}, root)
+	if err != context.Canceled || len(nodes) == 0 || len(nodes) >= total {
+		t.Errorf("expecting partial quick matches and context.Canceled, got %d, %v", len(nodes), err)
+	}
+	nodes, err = FindContext("class", "x")(context.Background(), root)
+	if err != nil || len(nodes) != total {
+		t.Errorf("expecting %d quick matches without error, got %d, %v", total, len(nodes), err)
+	}
+}
+
+// TestSubtreeDescs ...
+// Ensures descendant maps of siblings are never shared
+func TestSubtreeDescs(t *testing.T) {
+	const siblingHTML = `<html><body><div id="a"><p><b>1</b></p></div>
+		<div id="b"><p><b>2</b></p><p><b>3</b></p></div></body></html>`
+	var rc io.ReadCloser = &gardener.MockRC{bytes.NewBufferString(siblingHTML)}
+	stewie := NewFromReader(rc)
+	divA := stewie.Find("id", "a")[0]
+	divB := stewie.Find("id", "b")[0]
+
+	if n := len(divA.FindAll("b")); n != 1 {
+		t.Errorf("expecting 1 b under div#a, got %d", n)
+	}
+	if n := len(divB.FindAll("b")); n != 2 {
+		t.Errorf("expecting 2 b under div#b, got %d", n)
+	}
+	if n := len(stewie.FindAll("b")); n != 3 {
+		t.Errorf("expecting 3 b in document, got %d", n)
+	}
+}
+
+// =============================================
+//                    Benchmarks
+// =============================================
+
+// BenchmarkNewFromNodeDeep ...
+// Measures construction of a narrow tree nested benchDepth levels deep
+func BenchmarkNewFromNodeDeep(b *testing.B) {
+	benchmarkNewFromNode(b, deepHTML(benchDepth, 2))
+}
+
+// BenchmarkNewFromNodeWide ...
+// Measures construction of a shallow tree with many siblings
+func BenchmarkNewFromNodeWide(b *testing.B) {
+	benchmarkNewFromNode(b, deepHTML(4, benchWidth))
+}
+
 // =============================================
 //                    Private
 // =============================================
@@ -257,6 +501,49 @@ func treeCheck(expect *gardener.HTMLNode, got *Stew, errCheck func(msg string, a
 	}
 }
 
+//// Benchmark Utilities
+
+func benchmarkNewFromNode(b *testing.B, page string) {
+	root, err := html.Parse(bytes.NewBufferString(page))
+	panicCheck(err)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewFromNode(root)
+	}
+}
+
+// generates depth levels of nested divs, each also holding width spans
+func deepHTML(depth, width int) string {
+	var page bytes.Buffer
+	page.WriteString("<html><body>")
+	for i := 0; i < depth; i++ {
+		page.WriteString(`<div class="level">`)
+		for j := 0; j < width; j++ {
+			page.WriteString("<span>leaf</span>")
+		}
+	}
+	for i := 0; i < depth; i++ {
+		page.WriteString("</div>")
+	}
+	page.WriteString("</body></html>")
+	return page.String()
+}
+
+// context reporting cancellation after n calls to Err
+type countdownCtx struct {
+	context.Context
+	n int
+}
+
+func (this *countdownCtx) Err() error {
+	if this.n <= 0 {
+		return context.Canceled
+	}
+	this.n--
+	return nil
+}
+
 func panicCheck(e error) {
 	if e != nil {
 		panic(e)
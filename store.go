@@ -0,0 +1,416 @@
+//// file: store.go
+
+package stew
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// =============================================
+//                    Declarations
+// =============================================
+
+// Record ...
+// Is a flat set of named fields extracted from a page
+type Record map[string]interface{}
+
+// Store ...
+// Persists records, replacing any existing record with the same key
+type Store interface {
+	Upsert(records ...Record) error
+	Close() error
+}
+
+// SQLDialect ...
+// Selects placeholder syntax for SQLStore
+type SQLDialect int
+
+const (
+	// SQLite uses ? placeholders, ON CONFLICT requires sqlite 3.24+
+	SQLite SQLDialect = iota
+	// Postgres uses $n placeholders
+	Postgres
+)
+
+// SQLStore ...
+// Upserts records into a table of TEXT columns through database/sql.
+// Callers open the *sql.DB with the driver of their choice and own it.
+// Unlike CSVStore the columns are fixed, records with other fields are rejected
+type SQLStore struct {
+	db      *sql.DB
+	dialect SQLDialect
+	table   string
+	key     string
+	columns []string
+	upsert  string
+}
+
+// JSONStore ...
+// Keeps records in a JSON array file, rewritten on every upsert
+type JSONStore struct {
+	fileStore
+}
+
+// CSVStore ...
+// Keeps records in a CSV file with a header row, rewritten on every upsert
+type CSVStore struct {
+	fileStore
+	columns []string
+}
+
+// fileStore holds records in memory in first-insertion order
+type fileStore struct {
+	mu      sync.Mutex
+	path    string
+	key     string
+	order   []string
+	records map[string]Record
+	write   func(w io.Writer, order []string, records map[string]Record) error
+}
+
+// =============================================
+//                    Public
+// =============================================
+
+// NewSQLStore ...
+// Creates table if missing, with key as primary key followed by columns
+func NewSQLStore(db *sql.DB, dialect SQLDialect, table, key string, columns ...string) (*SQLStore, error) {
+	store := &SQLStore{db: db, dialect: dialect, table: table, key: key}
+	store.columns = append([]string{key}, withoutKey(columns, key)...)
+	if _, err := db.Exec(store.createStmt()); err != nil {
+		return nil, err
+	}
+	store.upsert = store.upsertStmt()
+	return store, nil
+}
+
+// Upsert ...
+// Writes records in a single transaction, writing nothing
+// if any record lacks the key or has a field outside the columns
+func (this *SQLStore) Upsert(records ...Record) error {
+	known := make(map[string]struct{}, len(this.columns))
+	for _, col := range this.columns {
+		known[col] = struct{}{}
+	}
+	for _, record := range records {
+		if _, ok := record[this.key]; !ok {
+			return fmt.Errorf("stew: record has no key field %q", this.key)
+		}
+		for field := range record {
+			if _, ok := known[field]; !ok {
+				return fmt.Errorf("stew: record field %q is not a column of %q", field, this.table)
+			}
+		}
+	}
+
+	tx, err := this.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(this.upsert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, record := range records {
+		args := make([]interface{}, len(this.columns))
+		for i, col := range this.columns {
+			if val, ok := record[col]; ok && val != nil {
+				args[i] = fieldString(val)
+			}
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Close ...
+// Is a no-op, the *sql.DB belongs to the caller
+func (this *SQLStore) Close() error {
+	return nil
+}
+
+// NewJSONStore ...
+// Opens the JSON store at path, loading any records already in it
+func NewJSONStore(path, key string) (*JSONStore, error) {
+	store := &JSONStore{fileStore: newFileStore(path, key)}
+	store.write = store.encode
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	if err := json.NewDecoder(f).Decode(&records); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if store.order, store.records, err = store.merge(records); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewCSVStore ...
+// Opens the CSV store at path, loading any records already in it.
+// Columns default to the existing header when empty
+func NewCSVStore(path, key string, columns ...string) (*CSVStore, error) {
+	store := &CSVStore{fileStore: newFileStore(path, key)}
+	store.write = store.encode
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		store.columns = append([]string{key}, withoutKey(columns, key)...)
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 && len(rows) > 0 {
+		columns = rows[0]
+	}
+	store.columns = append([]string{key}, withoutKey(columns, key)...)
+	var records []Record
+	for i := 1; i < len(rows); i++ {
+		record := make(Record)
+		for j, col := range rows[0] {
+			record[col] = rows[i][j]
+		}
+		records = append(records, record)
+	}
+	if store.order, store.records, err = store.merge(records); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Upsert ...
+// Replaces records by key and rewrites the file.
+// On error neither the file nor the stored records change
+func (this *fileStore) Upsert(records ...Record) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	order, merged, err := this.merge(records)
+	if err != nil {
+		return err
+	}
+	if err := this.flush(order, merged); err != nil {
+		return err
+	}
+	this.order, this.records = order, merged
+	return nil
+}
+
+// Records ...
+// Returns stored records in first-insertion order
+func (this *fileStore) Records() []Record {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	records := make([]Record, len(this.order))
+	for i, key := range this.order {
+		records[i] = this.records[key]
+	}
+	return records
+}
+
+// Close ...
+// Is a no-op, every upsert is already flushed
+func (this *fileStore) Close() error {
+	return nil
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+func newFileStore(path, key string) fileStore {
+	return fileStore{path: path, key: key, records: make(map[string]Record)}
+}
+
+// merge returns copies of the stored order and records with input records
+// replacing existing ones by key, expects this.mu held.
+// Fails unless every record has a key
+func (this *fileStore) merge(records []Record) ([]string, map[string]Record, error) {
+	for _, record := range records {
+		if _, ok := record[this.key]; !ok {
+			return nil, nil, fmt.Errorf("stew: record has no key field %q", this.key)
+		}
+	}
+	order := append(make([]string, 0, len(this.order)+len(records)), this.order...)
+	merged := make(map[string]Record, len(this.records)+len(records))
+	for key, record := range this.records {
+		merged[key] = record
+	}
+	for _, record := range records {
+		key := fieldString(record[this.key])
+		if _, ok := merged[key]; !ok {
+			order = append(order, key)
+		}
+		merged[key] = record
+	}
+	return order, merged, nil
+}
+
+// flush writes input state to a temporary file and renames it over path,
+// keeping the permissions of any existing file
+func (this *fileStore) flush(order []string, records map[string]Record) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(this.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(this.path), filepath.Base(this.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := this.write(tmp, order, records); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), this.path)
+}
+
+func (this *JSONStore) encode(w io.Writer, order []string, records map[string]Record) error {
+	list := make([]Record, len(order))
+	for i, key := range order {
+		list[i] = records[key]
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(list)
+}
+
+// encode writes the header and one row per record. The header is the
+// store's columns followed by fields first seen in records, in record order
+func (this *CSVStore) encode(w io.Writer, order []string, records map[string]Record) error {
+	columns := append([]string{}, this.columns...)
+	known := make(map[string]struct{})
+	for _, col := range columns {
+		known[col] = struct{}{}
+	}
+	for _, key := range order {
+		var extra []string
+		for col := range records[key] {
+			if _, ok := known[col]; !ok {
+				known[col] = struct{}{}
+				extra = append(extra, col)
+			}
+		}
+		sort.Strings(extra)
+		columns = append(columns, extra...)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(columns)
+	row := make([]string, len(columns))
+	for _, key := range order {
+		record := records[key]
+		for i, col := range columns {
+			row[i] = ""
+			if val, ok := record[col]; ok && val != nil {
+				row[i] = fieldString(val)
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (this *SQLStore) createStmt() string {
+	cols := make([]string, len(this.columns))
+	for i, col := range this.columns {
+		cols[i] = quoteIdent(col) + " TEXT"
+	}
+	cols[0] += " PRIMARY KEY"
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)",
+		quoteIdent(this.table), strings.Join(cols, ", "))
+}
+
+func (this *SQLStore) upsertStmt() string {
+	cols := make([]string, len(this.columns))
+	params := make([]string, len(this.columns))
+	var updates []string
+	for i, col := range this.columns {
+		cols[i] = quoteIdent(col)
+		if this.dialect == Postgres {
+			params[i] = "$" + strconv.Itoa(i+1)
+		} else {
+			params[i] = "?"
+		}
+		if i > 0 {
+			updates = append(updates, cols[i]+" = excluded."+cols[i])
+		}
+	}
+	conflict := "DO NOTHING"
+	if len(updates) > 0 {
+		conflict = "DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) %s",
+		quoteIdent(this.table), strings.Join(cols, ", "), strings.Join(params, ", "),
+		cols[0], conflict)
+}
+
+// quoteIdent double quotes an identifier, valid in both sqlite and postgres
+func quoteIdent(ident string) string {
+	return `"` + strings.Replace(ident, `"`, `""`, -1) + `"`
+}
+
+// fieldString renders scalar fields as text and everything else as JSON
+func fieldString(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	case bool, int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v)
+	}
+	if b, err := json.Marshal(val); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(val)
+}
+
+func withoutKey(columns []string, key string) []string {
+	out := make([]string, 0, len(columns))
+	for _, col := range columns {
+		if col != key {
+			out = append(out, col)
+		}
+	}
+	return out
+}
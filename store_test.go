@@ -0,0 +1,333 @@
+//// file: store_test.go
+
+package stew
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// =============================================
+//                    Globals
+// =============================================
+
+// fakeDriver is registered once, each dsn names its own fakeDB
+var fakeDriver = &recordingDriver{dbs: make(map[string]*fakeDB)}
+
+func init() {
+	sql.Register("stew-fake", fakeDriver)
+}
+
+// =============================================
+//                    Tests
+// =============================================
+
+// TestJSONStore ...
+// Validates JSONStore upserts by key and reloads from disk
+func TestJSONStore(t *testing.T) {
+	dir := tempDir()
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "records.json")
+
+	store, err := NewJSONStore(path, "url")
+	panicCheck(err)
+	panicCheck(store.Upsert(
+		Record{"url": "/a", "title": "first", "price": 3},
+		Record{"url": "/b", "title": "second"}))
+	panicCheck(store.Upsert(Record{"url": "/a", "title": "updated"}))
+	panicCheck(store.Close())
+
+	reopened, err := NewJSONStore(path, "url")
+	panicCheck(err)
+	records := reopened.Records()
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if records[0]["url"] != "/a" || records[0]["title"] != "updated" {
+		t.Errorf("expected /a to be updated in place, got %v", records[0])
+	}
+	if _, ok := records[0]["price"]; ok {
+		t.Errorf("expected upsert to replace the whole record, got %v", records[0])
+	}
+	if records[1]["title"] != "second" {
+		t.Errorf("expected /b to be kept, got %v", records[1])
+	}
+
+	if err := reopened.Upsert(Record{"url": "/c"}, Record{"title": "keyless"}); err == nil {
+		t.Errorf("expected error upserting record without key")
+	}
+	if records := reopened.Records(); len(records) != 2 {
+		t.Errorf("expected rejected batch to leave 2 records, got %d", len(records))
+	}
+}
+
+// TestFileStoreMode ...
+// Ensures rewriting a store keeps the file's permissions
+func TestFileStoreMode(t *testing.T) {
+	dir := tempDir()
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "records.json")
+
+	store, err := NewJSONStore(path, "url")
+	panicCheck(err)
+	panicCheck(store.Upsert(Record{"url": "/a"}))
+	info, err := os.Stat(path)
+	panicCheck(err)
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("expected new store file mode 0644, got %v", info.Mode().Perm())
+	}
+
+	panicCheck(os.Chmod(path, 0640))
+	panicCheck(store.Upsert(Record{"url": "/b"}))
+	info, err = os.Stat(path)
+	panicCheck(err)
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected store file mode 0640 to be kept, got %v", info.Mode().Perm())
+	}
+}
+
+// TestFileStoreFlushError ...
+// Ensures a batch that fails to reach disk is not kept in memory
+func TestFileStoreFlushError(t *testing.T) {
+	dir := tempDir()
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "records.csv")
+
+	store, err := NewCSVStore(path, "url")
+	panicCheck(err)
+	panicCheck(store.Upsert(Record{"url": "/a"}))
+	panicCheck(os.RemoveAll(dir))
+	if err := store.Upsert(Record{"url": "/b", "title": "lost"}); err == nil {
+		t.Fatalf("expected error flushing to a missing directory")
+	}
+	if records := store.Records(); len(records) != 1 {
+		t.Errorf("expected failed batch to leave 1 record, got %d", len(records))
+	}
+
+	panicCheck(os.MkdirAll(dir, 0755))
+	panicCheck(store.Upsert(Record{"url": "/c"}))
+	content, err := ioutil.ReadFile(path)
+	panicCheck(err)
+	if expect := "url\n/a\n/c\n"; string(content) != expect {
+		t.Errorf("expected csv %q, got %q", expect, string(content))
+	}
+}
+
+// TestCSVStore ...
+// Validates CSVStore upserts by key, grows columns and reloads from disk
+func TestCSVStore(t *testing.T) {
+	dir := tempDir()
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "records.csv")
+
+	store, err := NewCSVStore(path, "url", "title")
+	panicCheck(err)
+	panicCheck(store.Upsert(
+		Record{"url": "/a", "title": "first"},
+		Record{"url": "/b", "title": "second, with comma", "price": 4.5}))
+	panicCheck(store.Upsert(Record{"url": "/a", "title": "updated"}))
+
+	content, err := ioutil.ReadFile(path)
+	panicCheck(err)
+	expect := "url,title,price\n/a,updated,\n/b,\"second, with comma\",4.5\n"
+	if string(content) != expect {
+		t.Errorf("expected csv %q, got %q", expect, string(content))
+	}
+
+	reopened, err := NewCSVStore(path, "url")
+	panicCheck(err)
+	panicCheck(reopened.Upsert(Record{"url": "/b", "title": "replaced", "price": 5}))
+	content, err = ioutil.ReadFile(path)
+	panicCheck(err)
+	expect = "url,title,price\n/a,updated,\n/b,replaced,5\n"
+	if string(content) != expect {
+		t.Errorf("expected csv %q, got %q", expect, string(content))
+	}
+}
+
+// TestSQLStoreStatements ...
+// Validates generated DDL and upsert statements per dialect
+func TestSQLStoreStatements(t *testing.T) {
+	sqlite := &SQLStore{dialect: SQLite, table: "items", key: "url",
+		columns: []string{"url", "title", `odd"name`}}
+	expect := `CREATE TABLE IF NOT EXISTS "items" ("url" TEXT PRIMARY KEY, "title" TEXT, "odd""name" TEXT)`
+	if got := sqlite.createStmt(); got != expect {
+		t.Errorf("expected %s, got %s", expect, got)
+	}
+	expect = `INSERT INTO "items" ("url", "title", "odd""name") VALUES (?, ?, ?) ` +
+		`ON CONFLICT ("url") DO UPDATE SET "title" = excluded."title", "odd""name" = excluded."odd""name"`
+	if got := sqlite.upsertStmt(); got != expect {
+		t.Errorf("expected %s, got %s", expect, got)
+	}
+
+	postgres := &SQLStore{dialect: Postgres, table: "items", key: "url",
+		columns: []string{"url", "title"}}
+	expect = `INSERT INTO "items" ("url", "title") VALUES ($1, $2) ` +
+		`ON CONFLICT ("url") DO UPDATE SET "title" = excluded."title"`
+	if got := postgres.upsertStmt(); got != expect {
+		t.Errorf("expected %s, got %s", expect, got)
+	}
+
+	keyOnly := &SQLStore{dialect: SQLite, table: "seen", key: "url", columns: []string{"url"}}
+	if got := keyOnly.upsertStmt(); !strings.HasSuffix(got, "DO NOTHING") {
+		t.Errorf("expected key-only upsert to do nothing on conflict, got %s", got)
+	}
+}
+
+// TestSQLStore ...
+// Validates SQLStore upserts in a transaction and writes nothing for bad batches
+func TestSQLStore(t *testing.T) {
+	db, fake := openFakeDB()
+	defer db.Close()
+
+	store, err := NewSQLStore(db, SQLite, "items", "url", "title", "price")
+	panicCheck(err)
+	panicCheck(store.Upsert(
+		Record{"url": "/a", "title": "first", "price": 3},
+		Record{"url": "/b", "price": nil}))
+	expect := []string{
+		"CREATE []",
+		"begin",
+		"INSERT [/a first 3]",
+		"INSERT [/b <nil> <nil>]",
+		"commit",
+	}
+	if got := fake.statements(); !reflect.DeepEqual(expect, got) {
+		t.Errorf("expected statements %q, got %q", expect, got)
+	}
+
+	// invalid batches fail before the transaction starts
+	if err := store.Upsert(Record{"url": "/c"}, Record{"title": "keyless"}); err == nil {
+		t.Errorf("expected error upserting record without key")
+	}
+	if err := store.Upsert(Record{"url": "/c", "color": "red"}); err == nil {
+		t.Errorf("expected error upserting field outside the columns")
+	}
+	if got := fake.statements(); !reflect.DeepEqual(expect, got) {
+		t.Errorf("expected invalid batches to run nothing, got %q", got[len(expect):])
+	}
+
+	// failed statements roll back the batch
+	if err := store.Upsert(Record{"url": "/c"}, Record{"url": "fail"}); err == nil {
+		t.Errorf("expected error from failed statement")
+	}
+	expect = append(expect, "begin", "INSERT [/c <nil> <nil>]", "rollback")
+	if got := fake.statements(); !reflect.DeepEqual(expect, got) {
+		t.Errorf("expected statements %q, got %q", expect, got)
+	}
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+// fakeDB records transactions and statements run through recordingDriver.
+// Statements are logged by their first keyword and arguments,
+// those with a "fail" argument return an error instead
+type fakeDB struct {
+	mu  sync.Mutex
+	log []string
+}
+
+type recordingDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeDB
+}
+
+type fakeConn struct{ db *fakeDB }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+type fakeTx struct{ db *fakeDB }
+
+// openFakeDB opens a *sql.DB backed by a new fakeDB
+func openFakeDB() (*sql.DB, *fakeDB) {
+	fakeDriver.mu.Lock()
+	dsn := strconv.Itoa(len(fakeDriver.dbs))
+	fake := &fakeDB{}
+	fakeDriver.dbs[dsn] = fake
+	fakeDriver.mu.Unlock()
+	db, err := sql.Open("stew-fake", dsn)
+	panicCheck(err)
+	return db, fake
+}
+
+func (this *fakeDB) record(entry string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.log = append(this.log, entry)
+}
+
+func (this *fakeDB) statements() []string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return append([]string{}, this.log...)
+}
+
+func (this *recordingDriver) Open(dsn string) (driver.Conn, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	fake, ok := this.dbs[dsn]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake db %q", dsn)
+	}
+	return &fakeConn{fake}, nil
+}
+
+func (this *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{this.db, query}, nil
+}
+
+func (this *fakeConn) Close() error { return nil }
+
+func (this *fakeConn) Begin() (driver.Tx, error) {
+	this.db.record("begin")
+	return &fakeTx{this.db}, nil
+}
+
+func (this *fakeStmt) Close() error { return nil }
+
+func (this *fakeStmt) NumInput() int { return -1 }
+
+func (this *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	for _, arg := range args {
+		if arg == "fail" {
+			return nil, errors.New("fake statement failed")
+		}
+	}
+	this.db.record(fmt.Sprintf("%s %v", strings.Fields(this.query)[0], args))
+	return driver.RowsAffected(1), nil
+}
+
+func (this *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("fake db does not support queries")
+}
+
+func (this *fakeTx) Commit() error {
+	this.db.record("commit")
+	return nil
+}
+
+func (this *fakeTx) Rollback() error {
+	this.db.record("rollback")
+	return nil
+}
+
+func tempDir() string {
+	dir, err := ioutil.TempDir("", "stew")
+	panicCheck(err)
+	return dir
+}